@@ -1,3 +1,16 @@
 module github.com/tomkalesse/aws-embedded-metrics-go
 
 go 1.22.5
+
+require (
+	github.com/aws/aws-lambda-go v1.47.0
+	google.golang.org/grpc v1.66.2
+)
+
+require (
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240604185151-ef581f913117 // indirect
+	google.golang.org/protobuf v1.34.1 // indirect
+)
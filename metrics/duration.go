@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/context"
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/utils"
+)
+
+// PutDuration records a time.Duration under the given metric name. The value is converted
+// into the requested time unit, or into the unit the metric was first recorded with,
+// falling back to Milliseconds.
+func (l *MetricsLogger) PutDuration(key string, value time.Duration, unit ...Unit) {
+	l.putDuration(key, value, nil, unit...)
+}
+
+// StartTimer starts measuring a duration for the given metric name. The returned function
+// records the elapsed time when called, which makes it suitable for defer.
+func (l *MetricsLogger) StartTimer(key string, unit ...Unit) func() {
+	start := time.Now()
+	return func() {
+		l.PutDuration(key, time.Since(start), unit...)
+	}
+}
+
+// Time runs fn and records its duration under the given metric name, together with the
+// <key>Success and <key>Failure counts. The error returned by fn is passed through.
+func (l *MetricsLogger) Time(key string, fn func() error, unit ...Unit) error {
+	start := time.Now()
+	err := fn()
+	l.PutDuration(key, time.Since(start), unit...)
+
+	success, failure := 1.0, 0.0
+	if err != nil {
+		success, failure = 0.0, 1.0
+	}
+	l.PutMetric(key+"Success", success, utils.Count, utils.Standard)
+	l.PutMetric(key+"Failure", failure, utils.Count, utils.Standard)
+	return err
+}
+
+func (l *MetricsLogger) putDuration(key string, value time.Duration, options []MetricOption, unit ...Unit) {
+	u := l.durationUnit(context.MetricKey(key, newMetricDirective(options)), unit...)
+	converted, err := durationIn(value, u)
+	if err != nil {
+		slogger.Error(err.Error())
+		return
+	}
+	l.PutMetric(key, converted, u, utils.Standard, options...)
+}
+
+func (l *MetricsLogger) durationUnit(metricKey string, unit ...Unit) utils.Unit {
+	if len(unit) > 0 {
+		return unit[0]
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if existing, ok := l.context.Metrics[metricKey]; ok && utils.GetUnitFamily(existing.Unit) == utils.TimeUnits {
+		return existing.Unit
+	}
+	return utils.Milliseconds
+}
+
+func durationIn(value time.Duration, unit utils.Unit) (float64, error) {
+	switch unit {
+	case utils.Seconds:
+		return value.Seconds(), nil
+	case utils.Milliseconds:
+		return float64(value) / float64(time.Millisecond), nil
+	case utils.Microseconds:
+		return float64(value) / float64(time.Microsecond), nil
+	default:
+		return 0, errors.New("metric unit " + string(unit) + " is not a time unit")
+	}
+}
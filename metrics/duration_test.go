@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/context"
+)
+
+func newTestLogger() *MetricsLogger {
+	return &MetricsLogger{context: context.Empty(), flushPreserveDimensions: true, mutex: &sync.Mutex{}}
+}
+
+func TestPutDurationDefaultsToMilliseconds(t *testing.T) {
+
+	logger := newTestLogger()
+	logger.PutDuration("Latency", 1500*time.Microsecond)
+
+	metric := logger.context.Metrics["Latency"]
+	if metric.Unit != Milliseconds {
+		t.Errorf("Expected %v, got %v", Milliseconds, metric.Unit)
+	}
+	if len(metric.Values) != 1 || metric.Values[0] != 1.5 {
+		t.Errorf("Expected %v, got %v", []float64{1.5}, metric.Values)
+	}
+}
+
+func TestPutDurationConvertsToRequestedUnit(t *testing.T) {
+
+	testCases := []struct {
+		unit     Unit
+		expected float64
+	}{
+		{Seconds, 2},
+		{Milliseconds, 2000},
+		{Microseconds, 2000000},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.unit), func(t *testing.T) {
+			logger := newTestLogger()
+			logger.PutDuration("Latency", 2*time.Second, tc.unit)
+
+			metric := logger.context.Metrics["Latency"]
+			if metric.Unit != tc.unit {
+				t.Errorf("Expected %v, got %v", tc.unit, metric.Unit)
+			}
+			if metric.Values[0] != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, metric.Values[0])
+			}
+		})
+	}
+}
+
+func TestPutDurationUsesDeclaredUnit(t *testing.T) {
+
+	logger := newTestLogger()
+	logger.PutMetric("Latency", 1, Seconds, StorageResolutionStandard)
+	logger.PutDuration("Latency", 3*time.Second)
+
+	metric := logger.context.Metrics["Latency"]
+	if metric.Unit != Seconds {
+		t.Errorf("Expected %v, got %v", Seconds, metric.Unit)
+	}
+	if len(metric.Values) != 2 || metric.Values[1] != 3 {
+		t.Errorf("Expected %v, got %v", []float64{1, 3}, metric.Values)
+	}
+}
+
+func TestPutDurationRejectsNonTimeUnit(t *testing.T) {
+
+	logger := newTestLogger()
+	logger.PutDuration("Latency", time.Second, Bytes)
+
+	if _, ok := logger.context.Metrics["Latency"]; ok {
+		t.Errorf("Expected no metric to be recorded")
+	}
+}
+
+func TestStartTimerRecordsElapsedTime(t *testing.T) {
+
+	logger := newTestLogger()
+	stop := logger.StartTimer("Latency")
+	time.Sleep(2 * time.Millisecond)
+	stop()
+
+	metric := logger.context.Metrics["Latency"]
+	if len(metric.Values) != 1 || metric.Values[0] < 2 {
+		t.Errorf("Expected a value of at least 2ms, got %v", metric.Values)
+	}
+}
+
+func TestTimeRecordsSuccess(t *testing.T) {
+
+	logger := newTestLogger()
+	err := logger.Time("Call", func() error { return nil })
+
+	if err != nil {
+		t.Errorf("Expected nil but got error %v", err)
+	}
+	if len(logger.context.Metrics["Call"].Values) != 1 {
+		t.Errorf("Expected duration to be recorded")
+	}
+	if logger.context.Metrics["CallSuccess"].Values[0] != 1 || logger.context.Metrics["CallFailure"].Values[0] != 0 {
+		t.Errorf("Expected success count 1 and failure count 0")
+	}
+}
+
+func TestTimeRecordsFailureAndReturnsError(t *testing.T) {
+
+	logger := newTestLogger()
+	expectedErr := errors.New("failed")
+	err := logger.Time("Call", func() error { return expectedErr })
+
+	if err != expectedErr {
+		t.Errorf("Expected %v, got %v", expectedErr, err)
+	}
+	if logger.context.Metrics["CallSuccess"].Values[0] != 0 || logger.context.Metrics["CallFailure"].Values[0] != 1 {
+		t.Errorf("Expected success count 0 and failure count 1")
+	}
+}
@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/config"
+	metricscontext "github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/context"
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/environments"
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/sinks"
+)
+
+// SinkType selects where the events of an environment are written to.
+type SinkType string
+
+const (
+	// AgentSink sends events to the CloudWatch agent, see AGENT_ENDPOINT.
+	AgentSink SinkType = "AgentSink"
+	// ConsoleSink writes events to stdout.
+	ConsoleSink SinkType = "ConsoleSink"
+)
+
+// Probe priorities of the built-in environments, see RegisterEnvironment.
+const (
+	LambdaPriority           = environments.LambdaPriority
+	AppRunnerPriority        = environments.AppRunnerPriority
+	ECSPriority              = environments.ECSPriority
+	EKSPriority              = environments.EKSPriority
+	ElasticBeanstalkPriority = environments.ElasticBeanstalkPriority
+	EC2Priority              = environments.EC2Priority
+)
+
+// Environment is a platform the logger can run on. Probe is called concurrently with the
+// probes of the other environments.
+//
+// An environment may additionally implement ProbeError() error to tell why its last probe
+// failed, which is reported with the detection results.
+type Environment interface {
+	// Probe reports whether the process runs on this platform.
+	Probe() bool
+	// GetName returns the service name used if SERVICE_NAME is not configured.
+	GetName() string
+	// GetType returns the service type used if SERVICE_TYPE is not configured, e.g.
+	// "AWS::ECS::Container". It also names the probe in PROBE_ORDER and DISABLED_PROBES.
+	GetType() string
+	GetLogGroupName() string
+	// GetProperties returns the properties set on every event.
+	GetProperties() map[string]any
+	GetSinkType() SinkType
+}
+
+// RegisterEnvironment adds a custom environment to the environment discovery. All probes
+// run concurrently, and the environment with the highest priority whose probe succeeds is
+// used, from Lambda (LambdaPriority) down to EC2 (EC2Priority). An environment with the
+// same priority as another one ranks after it. The discovery gives up on probes that take
+// longer than the DISCOVERY_TIMEOUT config, 3s by default.
+//
+// The PROBE_ORDER config lists probes to run first, in the given order, and DISABLED_PROBES
+// lists probes to skip, e.g. AWS_EMF_DISABLED_PROBES=EC2 avoids the instance metadata
+// requests on hosts where they time out. Built-in probes are named Lambda, AppRunner, ECS,
+// EKS, ElasticBeanstalk and EC2, custom ones by their type.
+//
+// Environments have to be registered before the first logger is created.
+func RegisterEnvironment(env Environment, priority int) {
+	environments.RegisterEnvironment(env.GetType(), &registeredEnvironment{Environment: env}, priority)
+}
+
+// Init resolves the environment, which otherwise happens when the first logger is created.
+// Calling it at startup keeps the environment discovery out of the first request. If ctx is
+// done first, Init returns its error while the discovery goes on in the background.
+func Init(ctx context.Context) error {
+	resolved := make(chan error, 1)
+	go func() {
+		_, err := environments.ResolveEnvironment()
+		resolved <- err
+	}()
+
+	select {
+	case err := <-resolved:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close closes the connections of the environment sinks, e.g. the socket to the CloudWatch
+// agent, before the process exits. Loggers reopen them on their next flush.
+func Close() error {
+	return environments.Close()
+}
+
+// Reset closes the environment sinks like Close and forgets the resolved environment, so
+// the next logger resolves it again with the current config, e.g. between tests.
+func Reset() error {
+	return environments.Reset()
+}
+
+// registeredEnvironment adapts an Environment to the internal environment interface.
+type registeredEnvironment struct {
+	Environment
+	sink  sinks.Sink
+	mutex sync.Mutex
+}
+
+func (e *registeredEnvironment) ProbeError() error {
+	if env, ok := e.Environment.(interface{ ProbeError() error }); ok {
+		return env.ProbeError()
+	}
+	return nil
+}
+
+func (e *registeredEnvironment) ConfigureContext(ctx *metricscontext.MetricsContext) {
+	for key, value := range e.GetProperties() {
+		ctx.SetProperty(key, value)
+	}
+}
+
+func (e *registeredEnvironment) GetSink() sinks.Sink {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.sink == nil {
+		if e.GetSinkType() == ConsoleSink {
+			e.sink = sinks.NewConsoleSink()
+		} else {
+			env := config.GetConfig()
+			e.sink = sinks.NewAgentSink(e.GetLogGroupName(), env.LogStreamName)
+		}
+	}
+	return e.sink
+}
+
+func (e *registeredEnvironment) CloseSink() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.sink == nil {
+		return nil
+	}
+	err := e.sink.Close()
+	e.sink = nil
+	return err
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/environments"
+)
+
+type platformEnvironment struct {
+	matches bool
+}
+
+func (e *platformEnvironment) Probe() bool {
+	return e.matches
+}
+
+func (e *platformEnvironment) ProbeError() error {
+	return errors.New("not on the platform")
+}
+
+func (e *platformEnvironment) GetName() string {
+	return "checkout"
+}
+
+func (e *platformEnvironment) GetType() string {
+	return "Acme::Platform::App"
+}
+
+func (e *platformEnvironment) GetLogGroupName() string {
+	return "/acme/checkout"
+}
+
+func (e *platformEnvironment) GetProperties() map[string]any {
+	return map[string]any{"cell": "cell-1"}
+}
+
+func (e *platformEnvironment) GetSinkType() SinkType {
+	return ConsoleSink
+}
+
+func TestRegisterEnvironment(t *testing.T) {
+
+	t.Setenv("ENVIRONMENT", "")
+	t.Setenv("AWS_EMF_ENVIRONMENT", "")
+	t.Setenv("SERVICE_NAME", "")
+	t.Setenv("AWS_EMF_SERVICE_NAME", "")
+
+	env := &platformEnvironment{matches: true}
+	RegisterEnvironment(env, LambdaPriority+10)
+	t.Cleanup(func() {
+		env.matches = false
+		Reset()
+	})
+
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stderr)
+
+	if _, err := environments.CleanResolveEnvironment(); err != nil {
+		t.Fatalf("Failed to resolve environment: %v", err)
+	}
+	if detection := environments.LastDetection(); detection.Winner != "Acme::Platform::App" {
+		t.Errorf("Expected %v, got %v", "Acme::Platform::App", detection.Winner)
+	}
+
+	logger := CreateMetricsLogger()
+	logger.PutMetric("Orders", 1, Count, StorageResolutionStandard)
+	logger.Flush()
+
+	for _, expected := range []string{`"cell":"cell-1"`, `"ServiceName":"checkout"`, `"ServiceType":"Acme::Platform::App"`, `"LogGroup":"/acme/checkout"`} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("Expected %s in the flushed event, got %s", expected, output.String())
+		}
+	}
+}
+
+func TestInit(t *testing.T) {
+
+	t.Cleanup(func() {
+		Reset()
+	})
+	t.Setenv("AWS_EMF_ENVIRONMENT", "Local")
+	Reset()
+
+	if err := Init(context.Background()); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Init(ctx); err != nil && err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/context"
+)
+
+// MetricOption changes where a single metric is published.
+type MetricOption func(directive *context.MetricDirective)
+
+// WithDimensions publishes the metric under the given dimension sets instead of the
+// dimension sets of the logger. Default dimensions are still added to every set.
+func WithDimensions(dimensionSets ...map[string]string) MetricOption {
+	return func(directive *context.MetricDirective) {
+		if directive.Dimensions == nil {
+			directive.Dimensions = make([]map[string]string, 0, len(dimensionSets))
+		}
+		directive.Dimensions = append(directive.Dimensions, dimensionSets...)
+	}
+}
+
+// WithEmptyDimensionSet additionally publishes the metric without any dimensions.
+func WithEmptyDimensionSet() MetricOption {
+	return func(directive *context.MetricDirective) {
+		directive.EmptyDimensionSet = true
+	}
+}
+
+// WithNamespace publishes the metric under the given namespace instead of the namespace
+// of the logger. A metric name can be used in several namespaces, the metrics are then
+// flushed in separate events.
+func WithNamespace(namespace string) MetricOption {
+	return func(directive *context.MetricDirective) {
+		directive.Namespace = namespace
+	}
+}
+
+func newMetricDirective(options []MetricOption) *context.MetricDirective {
+	if len(options) == 0 {
+		return nil
+	}
+	directive := &context.MetricDirective{}
+	for _, option := range options {
+		option(directive)
+	}
+	return directive
+}
+
+// MetricGroup puts metrics that share the same options, e.g. the same dimension sets.
+// Metrics of a group are serialized into their own CloudWatchMetrics directive.
+type MetricGroup struct {
+	logger  *MetricsLogger
+	options []MetricOption
+}
+
+// Group returns a view of the logger that applies the given options to every metric.
+func (l *MetricsLogger) Group(options ...MetricOption) *MetricGroup {
+	return &MetricGroup{logger: l, options: options}
+}
+
+// Namespace returns a view of the logger that puts every metric into the given namespace.
+// The metrics are flushed together with the other metrics of the logger, as a separate
+// directive of the same event, unless a metric of the same name is also put into another
+// namespace, which is flushed in a separate event.
+func (l *MetricsLogger) Namespace(namespace string) *MetricGroup {
+	return l.Group(WithNamespace(namespace))
+}
+
+func (g *MetricGroup) PutMetric(key string, value float64, unit Unit, storageResolution StorageResolution) {
+	g.logger.PutMetric(key, value, unit, storageResolution, g.options...)
+}
+
+func (g *MetricGroup) PutDuration(key string, value time.Duration, unit ...Unit) {
+	g.logger.putDuration(key, value, g.options, unit...)
+}
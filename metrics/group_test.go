@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/utils"
+)
+
+func TestPutMetricWithDimensionsAttachesDirective(t *testing.T) {
+
+	logger := newTestLogger()
+	dimensions := map[string]string{"Customer": "c1"}
+	logger.PutMetric("Latency", 1, Milliseconds, StorageResolutionStandard, WithDimensions(dimensions))
+	logger.PutMetric("Requests", 1, Count, StorageResolutionStandard)
+
+	directive := logger.context.Metrics["Latency"].Directive
+	if directive == nil || !utils.AreArrayMapsEqual(directive.Dimensions, []map[string]string{dimensions}) {
+		t.Errorf("Expected %v, got %v", dimensions, directive)
+	}
+	if logger.context.Metrics["Requests"].Directive != nil {
+		t.Errorf("Expected no directive, got %v", logger.context.Metrics["Requests"].Directive)
+	}
+}
+
+func TestWithDimensionsWithConflictingDimensionSetsRecordsNothing(t *testing.T) {
+
+	logger := newTestLogger()
+	logger.PutMetric("Latency", 1, Milliseconds, StorageResolutionStandard, WithDimensions(
+		map[string]string{"Operation": "a"},
+		map[string]string{"Operation": "b", "Customer": "c1"},
+	))
+
+	if len(logger.context.Metrics) != 0 {
+		t.Errorf("Expected no metrics, got %v", logger.context.Metrics)
+	}
+}
+
+func TestGroupAppliesOptionsToEveryMetric(t *testing.T) {
+
+	logger := newTestLogger()
+	dimensions := map[string]string{"Operation": "Get", "Customer": "c1"}
+	group := logger.Group(WithDimensions(dimensions))
+	group.PutMetric("Requests", 1, Count, StorageResolutionStandard)
+	group.PutDuration("Latency", time.Second)
+
+	for _, name := range []string{"Requests", "Latency"} {
+		directive := logger.context.Metrics[name].Directive
+		if directive == nil || !utils.AreArrayMapsEqual(directive.Dimensions, []map[string]string{dimensions}) {
+			t.Errorf("Expected %v for %s, got %v", dimensions, name, directive)
+		}
+	}
+	if logger.context.Metrics["Latency"].Values[0] != 1000 {
+		t.Errorf("Expected %v, got %v", 1000, logger.context.Metrics["Latency"].Values)
+	}
+
+	batches, err := logger.context.Serialize()
+	if err != nil {
+		t.Fatalf("Serialization failed: %v", err)
+	}
+	if len(batches) != 1 {
+		t.Errorf("Expected 1 batch, but got %d", len(batches))
+	}
+}
+
+func TestWithDimensionsWithoutSetsUsesOnlyDefaultDimensions(t *testing.T) {
+
+	logger := newTestLogger()
+	logger.PutDimensions(map[string]string{"Operation": "Get"})
+	logger.PutMetric("Total", 1, Count, StorageResolutionStandard, WithDimensions())
+
+	directive := logger.context.Metrics["Total"].Directive
+	if directive == nil || directive.Dimensions == nil || len(directive.Dimensions) != 0 {
+		t.Errorf("Expected an empty list of dimension sets, got %v", directive)
+	}
+}
+
+func TestNamespaceRoutesMetricsIntoSeparateDirectives(t *testing.T) {
+
+	logger := newTestLogger()
+	logger.SetNamespace("Payments/API")
+	logger.PutMetric("Requests", 1, Count, StorageResolutionStandard)
+	logger.Namespace("Payments/Fraud").PutMetric("Score", 0.5, None, StorageResolutionStandard)
+	logger.PutMetric("Checks", 1, Count, StorageResolutionStandard, WithNamespace("Payments/Fraud"))
+
+	batches, err := logger.context.Serialize()
+	if err != nil {
+		t.Fatalf("Serialization failed: %v", err)
+	}
+	if len(batches) != 1 {
+		t.Fatalf("Expected 1 batch, but got %d", len(batches))
+	}
+
+	var event struct {
+		AWS struct {
+			CloudWatchMetrics []struct {
+				Namespace string
+				Metrics   []struct{ Name string }
+			}
+		} `json:"_aws"`
+	}
+	if err := json.Unmarshal([]byte(batches[0]), &event); err != nil {
+		t.Fatalf("Failed to parse event: %v", err)
+	}
+
+	namespaces := make(map[string]int)
+	for _, directive := range event.AWS.CloudWatchMetrics {
+		namespaces[directive.Namespace] += len(directive.Metrics)
+	}
+	if len(namespaces) != 2 || namespaces["Payments/API"] != 1 || namespaces["Payments/Fraud"] != 2 {
+		t.Errorf("Expected 1 metric in Payments/API and 2 in Payments/Fraud, got %v", namespaces)
+	}
+}
+
+func TestNamespaceWithSameMetricNameInSeveralNamespaces(t *testing.T) {
+
+	logger := newTestLogger()
+	logger.SetNamespace("Payments/API")
+	logger.PutDuration("Latency", 10*time.Millisecond)
+	logger.Namespace("Payments/Fraud").PutDuration("Latency", 2*time.Second, Seconds)
+	logger.Namespace("Payments/Fraud").PutDuration("Latency", 3*time.Second)
+
+	batches, err := logger.context.Serialize()
+	if err != nil {
+		t.Fatalf("Serialization failed: %v", err)
+	}
+	if len(batches) != 2 {
+		t.Fatalf("Expected 2 batches, but got %d", len(batches))
+	}
+
+	expected := map[string][]float64{"Payments/API": {10}, "Payments/Fraud": {2, 3}}
+	for _, batch := range batches {
+		var event struct {
+			AWS struct {
+				CloudWatchMetrics []struct {
+					Namespace string
+					Metrics   []struct{ Name, Unit string }
+				}
+			} `json:"_aws"`
+			Latency []float64
+		}
+		if err := json.Unmarshal([]byte(batch), &event); err != nil {
+			t.Fatalf("Failed to parse event: %v", err)
+		}
+		directives := event.AWS.CloudWatchMetrics
+		if len(directives) != 1 || directives[0].Metrics[0].Name != "Latency" {
+			t.Fatalf("Expected one Latency directive, got %v", directives)
+		}
+		namespace := directives[0].Namespace
+		if !reflect.DeepEqual(event.Latency, expected[namespace]) {
+			t.Errorf("Expected %v for %s, got %v", expected[namespace], namespace, event.Latency)
+		}
+	}
+}
+
+func TestNamespaceWithInvalidNamespaceRecordsNothing(t *testing.T) {
+
+	logger := newTestLogger()
+	logger.Namespace("Invalid Namespace!").PutMetric("Score", 1, None, StorageResolutionStandard)
+	logger.PutMetric("Checks", 1, Count, StorageResolutionStandard, WithNamespace(utils.GenerateString('a', 257)))
+
+	if len(logger.context.Metrics) != 0 {
+		t.Errorf("Expected no metrics, got %v", logger.context.Metrics)
+	}
+}
+
+func TestWithEmptyDimensionSetAttachesDirective(t *testing.T) {
+
+	logger := newTestLogger()
+	logger.PutMetric("Requests", 1, Count, StorageResolutionStandard, WithEmptyDimensionSet())
+
+	directive := logger.context.Metrics["Requests"].Directive
+	if directive == nil || !directive.EmptyDimensionSet || directive.Dimensions != nil {
+		t.Errorf("Expected only an empty dimension set, got %v", directive)
+	}
+}
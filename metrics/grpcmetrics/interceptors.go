@@ -0,0 +1,292 @@
+// Package grpcmetrics records embedded metrics for gRPC servers and clients.
+package grpcmetrics
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics"
+)
+
+const (
+	LatencyMetric          = "Latency"
+	ErrorsMetric           = "Errors"
+	MessagesReceivedMetric = "MessagesReceived"
+	MessagesSentMetric     = "MessagesSent"
+	ServiceDimension       = "Service"
+	MethodDimension        = "Method"
+	CodeDimension          = "Code"
+
+	// the client interceptors record under their own names, so the latency a client
+	// observes is not mixed with the latency of the server
+	ClientLatencyMetric          = "ClientLatency"
+	ClientErrorsMetric           = "ClientErrors"
+	ClientMessagesReceivedMetric = "ClientMessagesReceived"
+	ClientMessagesSentMetric     = "ClientMessagesSent"
+)
+
+type interceptorOptions struct {
+	logger *metrics.MetricsLogger
+}
+
+type Option func(options *interceptorOptions)
+
+// WithLogger sets the logger every per-RPC logger of a server interceptor is derived from.
+// Its namespace, dimensions and properties are inherited by the per-RPC loggers.
+func WithLogger(logger *metrics.MetricsLogger) Option {
+	return func(options *interceptorOptions) {
+		options.logger = logger
+	}
+}
+
+func newServerOptions(options []Option) interceptorOptions {
+	opts := interceptorOptions{}
+	for _, option := range options {
+		option(&opts)
+	}
+	if opts.logger == nil {
+		logger := metrics.CreateMetricsLogger()
+		opts.logger = &logger
+	}
+	return opts
+}
+
+// UnaryServerInterceptor gives every RPC its own logger, available to the handler through
+// metrics.FromContext. When the RPC completes, its latency and error count are recorded with
+// the Service, Method and Code dimensions and the logger is flushed, also when the handler
+// panics.
+func UnaryServerInterceptor(options ...Option) grpc.UnaryServerInterceptor {
+	opts := newServerOptions(options)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		logger := opts.logger.With(nil)
+		rpc := newRPC(info.FullMethod, serverMetrics)
+		defer rpc.finishOnPanic(logger)
+
+		resp, err = handler(metrics.NewContext(ctx, logger), req)
+		sent := 1
+		if err != nil {
+			sent = 0
+		}
+		rpc.finish(logger, err, 1, sent)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of UnaryServerInterceptor. It also
+// records the number of messages received and sent on the stream.
+func StreamServerInterceptor(options ...Option) grpc.StreamServerInterceptor {
+	opts := newServerOptions(options)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		logger := opts.logger.With(nil)
+		rpc := newRPC(info.FullMethod, serverMetrics)
+		defer rpc.finishOnPanic(logger)
+
+		stream := &serverStream{ServerStream: ss, ctx: metrics.NewContext(ss.Context(), logger)}
+		err := handler(srv, stream)
+		received, sent := stream.counts()
+		rpc.finish(logger, err, received, sent)
+		return err
+	}
+}
+
+// UnaryClientInterceptor records the latency and error count of outbound RPCs on a child of
+// the logger returned by metrics.FromContext for the call context, as ClientLatency and
+// ClientErrors. The child has the Service, Method and Code dimensions and is flushed when
+// the call completes.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		rpc := newRPC(method, clientMetrics)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		received := 1
+		if err != nil {
+			received = 0
+		}
+		rpc.finish(metrics.FromContext(ctx).With(nil), err, received, 1)
+		return err
+	}
+}
+
+// StreamClientInterceptor is the streaming counterpart of UnaryClientInterceptor. The call
+// completes, and its metrics are flushed, when RecvMsg returns io.EOF or an error, for
+// calls without server streaming when RecvMsg returns the response, or when ctx is done
+// before either, e.g. because the caller cancels a server stream without draining it.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		rpc := newRPC(method, clientMetrics)
+		logger := metrics.FromContext(ctx).With(nil)
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			rpc.finish(logger, err, 0, 0)
+			return nil, err
+		}
+		s := &clientStream{ClientStream: cs, rpc: rpc, logger: logger, serverStreams: desc.ServerStreams, done: make(chan struct{})}
+		go s.finishOnDone(ctx)
+		return s, nil
+	}
+}
+
+// rpcMetrics names the metrics of one side of an RPC.
+type rpcMetrics struct {
+	latency  string
+	errors   string
+	received string
+	sent     string
+}
+
+var (
+	serverMetrics = rpcMetrics{LatencyMetric, ErrorsMetric, MessagesReceivedMetric, MessagesSentMetric}
+	clientMetrics = rpcMetrics{ClientLatencyMetric, ClientErrorsMetric, ClientMessagesReceivedMetric, ClientMessagesSentMetric}
+)
+
+type rpc struct {
+	service string
+	method  string
+	metrics rpcMetrics
+	start   time.Time
+}
+
+func newRPC(fullMethod string, names rpcMetrics) *rpc {
+	service, method, found := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !found {
+		service, method = "Unknown", fullMethod
+	}
+	return &rpc{service: service, method: method, metrics: names, start: time.Now()}
+}
+
+func (r *rpc) finish(logger *metrics.MetricsLogger, err error, received, sent int) {
+	code := status.Code(err)
+	logger.PutDimensions(map[string]string{
+		ServiceDimension: r.service,
+		MethodDimension:  r.method,
+		CodeDimension:    code.String(),
+	})
+	logger.PutDuration(r.metrics.latency, time.Since(r.start), metrics.Milliseconds)
+	errors := 0.0
+	if err != nil {
+		errors = 1
+	}
+	logger.PutMetric(r.metrics.errors, errors, metrics.Count, metrics.StorageResolutionStandard)
+	logger.PutMetric(r.metrics.received, float64(received), metrics.Count, metrics.StorageResolutionStandard)
+	logger.PutMetric(r.metrics.sent, float64(sent), metrics.Count, metrics.StorageResolutionStandard)
+	logger.Flush()
+}
+
+// finishOnPanic flushes the metrics of an RPC whose handler panicked and propagates the
+// panic afterwards.
+func (r *rpc) finishOnPanic(logger *metrics.MetricsLogger) {
+	if recovered := recover(); recovered != nil {
+		r.finish(logger, status.Error(codes.Internal, "panic"), 0, 0)
+		panic(recovered)
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	mutex    sync.Mutex
+	received int
+	sent     int
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	s.mutex.Lock()
+	if err == nil {
+		s.received++
+	}
+	s.mutex.Unlock()
+	return err
+}
+
+func (s *serverStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	s.mutex.Lock()
+	if err == nil {
+		s.sent++
+	}
+	s.mutex.Unlock()
+	return err
+}
+
+func (s *serverStream) counts() (int, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.received, s.sent
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	rpc           *rpc
+	logger        *metrics.MetricsLogger
+	serverStreams bool
+	mutex         sync.Mutex
+	received      int
+	sent          int
+	finished      bool
+	done          chan struct{}
+}
+
+func (s *clientStream) SendMsg(m any) error {
+	err := s.ClientStream.SendMsg(m)
+	s.mutex.Lock()
+	if err == nil {
+		s.sent++
+	}
+	s.mutex.Unlock()
+	return err
+}
+
+func (s *clientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err == nil {
+		s.received++
+		// without server streaming, generated code like CloseAndRecv reads the only
+		// response and never calls RecvMsg again
+		if !s.serverStreams {
+			s.finish(nil)
+		}
+		return nil
+	}
+	if err == io.EOF {
+		s.finish(nil)
+	} else {
+		s.finish(err)
+	}
+	return err
+}
+
+// finishOnDone finishes the call with the error of ctx if ctx is done before the call
+// completes.
+func (s *clientStream) finishOnDone(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.finish(status.FromContextError(ctx.Err()).Err())
+	case <-s.done:
+	}
+}
+
+// finish records the call once. The caller must hold the mutex.
+func (s *clientStream) finish(err error) {
+	if s.finished {
+		return
+	}
+	s.finished = true
+	close(s.done)
+	s.rpc.finish(s.logger, err, s.received, s.sent)
+}
@@ -0,0 +1,323 @@
+package grpcmetrics
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics"
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/testutil"
+)
+
+var output = &testutil.Events{}
+
+// healthServer answers Check with the status of the requested service, fails unknown
+// services and streams two updates from Watch.
+type healthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+}
+
+func (s *healthServer) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	metrics.FromContext(ctx).SetProperty("CheckedService", req.Service)
+	switch req.Service {
+	case "panic":
+		panic("boom")
+	case "":
+		return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+	default:
+		return nil, status.Error(codes.NotFound, "unknown service")
+	}
+}
+
+func (s *healthServer) Watch(req *grpc_health_v1.HealthCheckRequest, stream grpc_health_v1.Health_WatchServer) error {
+	metrics.FromContext(stream.Context()).SetProperty("CheckedService", req.Service)
+	for _, serving := range []grpc_health_v1.HealthCheckResponse_ServingStatus{
+		grpc_health_v1.HealthCheckResponse_NOT_SERVING,
+		grpc_health_v1.HealthCheckResponse_SERVING,
+	} {
+		if err := stream.Send(&grpc_health_v1.HealthCheckResponse{Status: serving}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newTestClient(t *testing.T, serverOptions []grpc.ServerOption, dialOptions ...grpc.DialOption) grpc_health_v1.HealthClient {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(serverOptions...)
+	grpc_health_v1.RegisterHealthServer(server, &healthServer{})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	dialOptions = append(dialOptions,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	conn, err := grpc.NewClient("passthrough:///bufnet", dialOptions...)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return grpc_health_v1.NewHealthClient(conn)
+}
+
+func instrumentedServer(logger *metrics.MetricsLogger) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(UnaryServerInterceptor(WithLogger(logger))),
+		grpc.StreamInterceptor(StreamServerInterceptor(WithLogger(logger))),
+	}
+}
+
+func newTestLogger() *metrics.MetricsLogger {
+	logger := testutil.NewLogger(output)
+	logger.SetNamespace("GrpcTest")
+	return logger
+}
+
+// metricValue unwraps the single value a metric was recorded with.
+func metricValue(event map[string]any, key string) any {
+	if values, ok := event[key].([]any); ok && len(values) == 1 {
+		return values[0]
+	}
+	return event[key]
+}
+
+func assertRPC(t *testing.T, names rpcMetrics, event map[string]any, method, code string, errors, received, sent float64) {
+	t.Helper()
+
+	expectedValues := map[string]any{
+		ServiceDimension: "grpc.health.v1.Health",
+		MethodDimension:  method,
+		CodeDimension:    code,
+		names.errors:     errors,
+		names.received:   received,
+		names.sent:       sent,
+	}
+	for key, expected := range expectedValues {
+		if value := metricValue(event, key); value != expected {
+			t.Errorf("Expected %s to be %v, got %v", key, expected, value)
+		}
+	}
+	if _, ok := metricValue(event, names.latency).(float64); !ok {
+		t.Errorf("Expected %s to be recorded, got %v", names.latency, event[names.latency])
+	}
+
+	directives := event["_aws"].(map[string]any)["CloudWatchMetrics"].([]any)
+	dimensionSet, _ := json.Marshal(directives[0].(map[string]any)["Dimensions"])
+	for _, dimension := range []string{ServiceDimension, MethodDimension, CodeDimension} {
+		if !strings.Contains(string(dimensionSet), `"`+dimension+`"`) {
+			t.Errorf("Expected dimension %s in %s", dimension, dimensionSet)
+		}
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+
+	client := newTestClient(t, instrumentedServer(newTestLogger()))
+
+	tests := []struct {
+		name    string
+		service string
+		code    string
+		errors  float64
+		sent    float64
+	}{
+		{name: "Success", service: "", code: "OK", errors: 0, sent: 1},
+		{name: "Error", service: "unknown", code: "NotFound", errors: 1, sent: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output.Flushed(t)
+			client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: tt.service})
+
+			events := output.Flushed(t)
+			if len(events) != 1 {
+				t.Fatalf("Expected 1 event, got %d", len(events))
+			}
+			assertRPC(t, serverMetrics, events[0], "Check", tt.code, tt.errors, 1, tt.sent)
+			if events[0]["CheckedService"] != tt.service {
+				t.Errorf("Expected CheckedService %v, got %v", tt.service, events[0]["CheckedService"])
+			}
+		})
+	}
+}
+
+func TestUnaryServerInterceptorFlushesOnPanic(t *testing.T) {
+
+	logger := newTestLogger()
+	interceptor := UnaryServerInterceptor(WithLogger(logger))
+	info := &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}
+	output.Flushed(t)
+
+	func() {
+		defer func() {
+			if recovered := recover(); recovered != "boom" {
+				t.Errorf("Expected the panic to be propagated, got %v", recovered)
+			}
+		}()
+		interceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+			panic("boom")
+		})
+	}()
+
+	events := output.Flushed(t)
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	assertRPC(t, serverMetrics, events[0], "Check", "Internal", 1, 0, 0)
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+
+	client := newTestClient(t, instrumentedServer(newTestLogger()))
+	output.Flushed(t)
+
+	stream, err := client.Watch(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: "watched"})
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	for {
+		if _, err := stream.Recv(); err != nil {
+			if err != io.EOF {
+				t.Fatalf("Recv failed: %v", err)
+			}
+			break
+		}
+	}
+
+	events := output.Flushed(t)
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	assertRPC(t, serverMetrics, events[0], "Watch", "OK", 0, 1, 2)
+	if events[0]["CheckedService"] != "watched" {
+		t.Errorf("Expected CheckedService %v, got %v", "watched", events[0]["CheckedService"])
+	}
+}
+
+func TestClientInterceptors(t *testing.T) {
+
+	client := newTestClient(t, nil,
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(StreamClientInterceptor()),
+	)
+	logger := newTestLogger()
+	logger.SetProperty("Caller", "test")
+	ctx := metrics.NewContext(context.Background(), logger)
+
+	t.Run("Unary", func(t *testing.T) {
+		output.Flushed(t)
+		client.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: "unknown"})
+
+		events := output.Flushed(t)
+		if len(events) != 1 {
+			t.Fatalf("Expected 1 event, got %d", len(events))
+		}
+		assertRPC(t, clientMetrics, events[0], "Check", "NotFound", 1, 0, 1)
+		if events[0]["Caller"] != "test" {
+			t.Errorf("Expected the properties of the context logger, got %v", events[0]["Caller"])
+		}
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		output.Flushed(t)
+		stream, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+		if err != nil {
+			t.Fatalf("Watch failed: %v", err)
+		}
+		for {
+			if _, err := stream.Recv(); err != nil {
+				break
+			}
+		}
+		// further reads do not record the call again
+		stream.Recv()
+
+		events := output.Flushed(t)
+		if len(events) != 1 {
+			t.Fatalf("Expected 1 event, got %d", len(events))
+		}
+		assertRPC(t, clientMetrics, events[0], "Watch", "OK", 0, 2, 1)
+	})
+
+	t.Run("CanceledStream", func(t *testing.T) {
+		output.Flushed(t)
+		streamCtx, cancel := context.WithCancel(ctx)
+		stream, err := client.Watch(streamCtx, &grpc_health_v1.HealthCheckRequest{})
+		if err != nil {
+			t.Fatalf("Watch failed: %v", err)
+		}
+		if _, err := stream.Recv(); err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		// the caller gives up without draining the stream
+		cancel()
+
+		events := output.Flushed(t)
+		for deadline := time.Now().Add(time.Second); len(events) == 0 && time.Now().Before(deadline); {
+			time.Sleep(10 * time.Millisecond)
+			events = output.Flushed(t)
+		}
+		if len(events) != 1 {
+			t.Fatalf("Expected 1 event, got %d", len(events))
+		}
+		assertRPC(t, clientMetrics, events[0], "Watch", "Canceled", 1, 1, 1)
+	})
+}
+
+// uploadStream stands in for a client-streaming call, which answers with a single response.
+type uploadStream struct {
+	grpc.ClientStream
+}
+
+func (s *uploadStream) SendMsg(m any) error {
+	return nil
+}
+
+func (s *uploadStream) CloseSend() error {
+	return nil
+}
+
+func (s *uploadStream) RecvMsg(m any) error {
+	return nil
+}
+
+func TestStreamClientInterceptorFinishesClientStreamingCall(t *testing.T) {
+
+	interceptor := StreamClientInterceptor()
+	desc := &grpc.StreamDesc{StreamName: "Upload", ClientStreams: true}
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return &uploadStream{}, nil
+	}
+	output.Flushed(t)
+
+	stream, err := interceptor(metrics.NewContext(context.Background(), newTestLogger()), desc, nil, "/grpc.health.v1.Health/Upload", streamer)
+	if err != nil {
+		t.Fatalf("Expected nil but got error %v", err)
+	}
+	stream.SendMsg(nil)
+	stream.SendMsg(nil)
+	// like the generated CloseAndRecv, which reads the response once
+	stream.CloseSend()
+	stream.RecvMsg(nil)
+
+	events := output.Flushed(t)
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	assertRPC(t, clientMetrics, events[0], "Upload", "OK", 0, 1, 2)
+}
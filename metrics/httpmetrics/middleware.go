@@ -0,0 +1,150 @@
+// Package httpmetrics records embedded metrics for net/http servers and clients.
+package httpmetrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics"
+)
+
+const (
+	LatencyMetric       = "Latency"
+	ResponseBytesMetric = "ResponseBytes"
+	RouteDimension      = "Route"
+	MethodDimension     = "Method"
+	StatusCodeDimension = "StatusCode"
+)
+
+// statusClassMetrics are recorded for every request, one of them with 1 and the others
+// with 0, so the sum of each metric is the number of responses of its class.
+var statusClassMetrics = []string{"Status2xx", "Status3xx", "Status4xx", "Status5xx"}
+
+// RouteExtractor returns the route of a request, e.g. the pattern that matched it. An empty
+// route omits the Route dimension.
+type RouteExtractor func(r *http.Request) string
+
+// RouteFromServeMux returns the ServeMux pattern that matches the request, for example
+// "GET /items/{id}", so path parameters don't end up as dimension values.
+func RouteFromServeMux(mux *http.ServeMux) RouteExtractor {
+	return func(r *http.Request) string {
+		_, pattern := mux.Handler(r)
+		return pattern
+	}
+}
+
+type middlewareOptions struct {
+	logger         *metrics.MetricsLogger
+	routeExtractor RouteExtractor
+}
+
+type MiddlewareOption func(options *middlewareOptions)
+
+// WithLogger sets the logger every per-request logger is derived from. Its namespace,
+// dimensions and properties are inherited by the per-request loggers.
+func WithLogger(logger *metrics.MetricsLogger) MiddlewareOption {
+	return func(options *middlewareOptions) {
+		options.logger = logger
+	}
+}
+
+func WithRouteExtractor(routeExtractor RouteExtractor) MiddlewareOption {
+	return func(options *middlewareOptions) {
+		options.routeExtractor = routeExtractor
+	}
+}
+
+// Middleware gives every request its own logger, available to the handler through
+// metrics.FromContext(r.Context()). After the handler returns, the latency, the status
+// class counts and the response size are recorded with the route, method and status code
+// as dimensions, and the logger is flushed. The logger is flushed even if the handler
+// panics; the panic is propagated afterwards.
+func Middleware(next http.Handler, options ...MiddlewareOption) http.Handler {
+	opts := middlewareOptions{
+		routeExtractor: func(r *http.Request) string { return "" },
+	}
+	for _, option := range options {
+		option(&opts)
+	}
+	if opts.logger == nil {
+		logger := metrics.CreateMetricsLogger()
+		opts.logger = &logger
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := opts.logger.With(nil)
+		recorder := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		start := time.Now()
+
+		defer func() {
+			recovered := recover()
+			if recovered != nil {
+				recorder.statusCode = http.StatusInternalServerError
+			}
+			recordRequest(logger, r, opts.routeExtractor(r), recorder, time.Since(start))
+			logger.Flush()
+			if recovered != nil {
+				panic(recovered)
+			}
+		}()
+
+		next.ServeHTTP(recorder, r.WithContext(metrics.NewContext(r.Context(), logger)))
+	})
+}
+
+func recordRequest(logger *metrics.MetricsLogger, r *http.Request, route string, recorder *responseRecorder, latency time.Duration) {
+	dimensions := map[string]string{
+		MethodDimension:     r.Method,
+		StatusCodeDimension: strconv.Itoa(recorder.statusCode),
+	}
+	if route != "" {
+		dimensions[RouteDimension] = route
+	}
+	logger.PutDimensions(dimensions)
+
+	logger.PutDuration(LatencyMetric, latency, metrics.Milliseconds)
+	logger.PutMetric(ResponseBytesMetric, float64(recorder.bytes), metrics.Bytes, metrics.StorageResolutionStandard)
+	class := recorder.statusCode/100 - 2
+	for i, name := range statusClassMetrics {
+		value := 0.0
+		if i == class {
+			value = 1
+		}
+		logger.PutMetric(name, value, metrics.Count, metrics.StorageResolutionStandard)
+	}
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	// informational responses are followed by the final status code
+	if !r.wroteHeader && statusCode >= http.StatusOK {
+		r.statusCode = statusCode
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,125 @@
+package httpmetrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics"
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/testutil"
+)
+
+var output = &testutil.Events{}
+
+func TestMiddlewareRecordsRequestMetrics(t *testing.T) {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		metrics.FromContext(r.Context()).SetProperty("ItemId", r.PathValue("id"))
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "not found")
+	})
+	server := httptest.NewServer(Middleware(mux, WithLogger(testutil.NewLogger(output)), WithRouteExtractor(RouteFromServeMux(mux))))
+	defer server.Close()
+	output.Flushed(t)
+
+	resp, err := http.Get(server.URL + "/items/42")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	events := output.Flushed(t)
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	event := events[0]
+
+	expected := map[string]any{
+		"Route":         "GET /items/{id}",
+		"Method":        "GET",
+		"StatusCode":    "404",
+		"ItemId":        "42",
+		"ResponseBytes": []any{9.0},
+		"Status2xx":     []any{0.0},
+		"Status4xx":     []any{1.0},
+		"Status5xx":     []any{0.0},
+	}
+	for key, value := range expected {
+		if !jsonEqual(event[key], value) {
+			t.Errorf("Expected %v for %s, got %v", value, key, event[key])
+		}
+	}
+	if _, ok := event["Latency"]; !ok {
+		t.Errorf("Expected latency to be recorded")
+	}
+}
+
+func TestMiddlewareGivesEveryRequestItsOwnLogger(t *testing.T) {
+
+	base := testutil.NewLogger(output)
+	base.SetProperty("Service", "api")
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := metrics.FromContext(r.Context())
+		logger.PutMetric("Items", 1, metrics.Count, metrics.StorageResolutionStandard)
+		logger.SetProperty("Path", r.URL.Path)
+	}), WithLogger(base))
+	output.Flushed(t)
+
+	for _, path := range []string{"/a", "/b"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	events := output.Flushed(t)
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	for i, path := range []string{"/a", "/b"} {
+		if events[i]["Path"] != path || events[i]["Service"] != "api" || !jsonEqual(events[i]["Items"], []any{1.0}) {
+			t.Errorf("Expected one item for %s, got %v", path, events[i])
+		}
+	}
+
+	base.Flush()
+	if events := output.Flushed(t); len(events) != 0 {
+		t.Errorf("Expected the base logger to have no metrics, got %v", events)
+	}
+}
+
+func TestMiddlewareFlushesOnPanic(t *testing.T) {
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metrics.FromContext(r.Context()).SetProperty("Before", "panic")
+		panic("boom")
+	}), WithLogger(testutil.NewLogger(output)))
+	output.Flushed(t)
+
+	func() {
+		defer func() {
+			if recovered := recover(); recovered != "boom" {
+				t.Errorf("Expected the panic to be propagated, got %v", recovered)
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	}()
+
+	events := output.Flushed(t)
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	if events[0]["StatusCode"] != "500" || events[0]["Before"] != "panic" || !jsonEqual(events[0]["Status5xx"], []any{1.0}) {
+		t.Errorf("Expected a 500 response to be recorded, got %v", events[0])
+	}
+	if _, ok := events[0]["Route"]; ok {
+		t.Errorf("Expected no Route dimension without route extractor")
+	}
+}
+
+func jsonEqual(a, b any) bool {
+	aBytes, _ := json.Marshal(a)
+	bBytes, _ := json.Marshal(b)
+	return bytes.Equal(aBytes, bBytes)
+}
@@ -0,0 +1,199 @@
+package httpmetrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics"
+)
+
+const (
+	OutboundLatencyMetric    = "OutboundLatency"
+	OutboundErrorsMetric     = "OutboundErrors"
+	RemoteHostDimension      = "RemoteHost"
+	RemoteOperationDimension = "RemoteOperation"
+	// OtherDimensionValue replaces dimension values that are not allowed or exceed the
+	// configured number of distinct values.
+	OtherDimensionValue = "Other"
+)
+
+// outboundStatusClassMetrics are the counterpart of statusClassMetrics for outbound calls,
+// so inbound and outbound responses never share a series.
+var outboundStatusClassMetrics = []string{"OutboundStatus2xx", "OutboundStatus3xx", "OutboundStatus4xx", "OutboundStatus5xx"}
+
+const (
+	DNSError               = "DNSError"
+	TimeoutError           = "TimeoutError"
+	ConnectionRefusedError = "ConnectionRefusedError"
+	OtherError             = "OtherError"
+)
+
+// OperationExtractor returns the operation of an outbound request, e.g. the name of the
+// API that is called.
+type OperationExtractor func(r *http.Request) string
+
+type transportOptions struct {
+	operationExtractor   OperationExtractor
+	allowedHosts         map[string]bool
+	maxDimensionValues   int
+	hosts                *boundedValues
+	operations           *boundedValues
+	additionalDimensions map[string]string
+}
+
+type TransportOption func(options *transportOptions)
+
+// WithOperationExtractor sets how the RemoteOperation dimension is derived. By default the
+// HTTP method is used, never the URL path.
+func WithOperationExtractor(operationExtractor OperationExtractor) TransportOption {
+	return func(options *transportOptions) {
+		options.operationExtractor = operationExtractor
+	}
+}
+
+// WithAllowedHosts limits the RemoteHost dimension to the given hosts. Other hosts are
+// recorded as "Other".
+func WithAllowedHosts(hosts ...string) TransportOption {
+	return func(options *transportOptions) {
+		options.allowedHosts = make(map[string]bool, len(hosts))
+		for _, host := range hosts {
+			options.allowedHosts[host] = true
+		}
+	}
+}
+
+// WithMaxDimensionValues limits the number of distinct values of the RemoteHost and
+// RemoteOperation dimensions. Values seen after the limit is reached are recorded as
+// "Other". The default is 100.
+func WithMaxDimensionValues(max int) TransportOption {
+	return func(options *transportOptions) {
+		options.maxDimensionValues = max
+	}
+}
+
+// WithTransportDimensions adds fixed dimensions to the metrics of every outbound call.
+func WithTransportDimensions(dimensions map[string]string) TransportOption {
+	return func(options *transportOptions) {
+		options.additionalDimensions = dimensions
+	}
+}
+
+type transport struct {
+	next    http.RoundTripper
+	options transportOptions
+}
+
+// NewTransport wraps an http.RoundTripper, http.DefaultTransport if nil, and records the
+// latency, the error counts by type and the status class counts of every call.
+//
+// The metrics are recorded on a child of the logger returned by metrics.FromContext for the
+// request context, with the RemoteHost and RemoteOperation dimensions layered on top of
+// its dimensions. The child is flushed when the call completes, because several calls of
+// one request can have different dimension values, which a single event cannot hold.
+func NewTransport(next http.RoundTripper, options ...TransportOption) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	opts := transportOptions{
+		operationExtractor: func(r *http.Request) string { return r.Method },
+		maxDimensionValues: 100,
+	}
+	for _, option := range options {
+		option(&opts)
+	}
+	opts.hosts = newBoundedValues(opts.maxDimensionValues)
+	opts.operations = newBoundedValues(opts.maxDimensionValues)
+	return &transport{next: next, options: opts}
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(r)
+	latency := time.Since(start)
+
+	logger := metrics.FromContext(r.Context()).With(t.dimensions(r))
+	logger.PutDuration(OutboundLatencyMetric, latency, metrics.Milliseconds)
+	if err != nil {
+		logger.PutMetric(OutboundErrorsMetric, 1, metrics.Count, metrics.StorageResolutionStandard)
+		logger.PutMetric(classifyError(r.Context(), err), 1, metrics.Count, metrics.StorageResolutionStandard)
+	} else {
+		logger.PutMetric(OutboundErrorsMetric, 0, metrics.Count, metrics.StorageResolutionStandard)
+		class := resp.StatusCode/100 - 2
+		for i, name := range outboundStatusClassMetrics {
+			value := 0.0
+			if i == class {
+				value = 1
+			}
+			logger.PutMetric(name, value, metrics.Count, metrics.StorageResolutionStandard)
+		}
+	}
+	logger.Flush()
+
+	return resp, err
+}
+
+func (t *transport) dimensions(r *http.Request) map[string]string {
+	dimensions := make(map[string]string, len(t.options.additionalDimensions)+2)
+	for key, value := range t.options.additionalDimensions {
+		dimensions[key] = value
+	}
+
+	host := r.URL.Hostname()
+	if t.options.allowedHosts != nil && !t.options.allowedHosts[host] {
+		host = OtherDimensionValue
+	}
+	if host != "" {
+		dimensions[RemoteHostDimension] = t.options.hosts.get(host)
+	}
+
+	if operation := t.options.operationExtractor(r); operation != "" {
+		dimensions[RemoteOperationDimension] = t.options.operations.get(operation)
+	}
+	return dimensions
+}
+
+func classifyError(ctx context.Context, err error) string {
+	var dnsError *net.DNSError
+	if errors.As(err, &dnsError) {
+		return DNSError
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return ConnectionRefusedError
+	}
+	var netError net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(context.Cause(ctx), context.DeadlineExceeded) || (errors.As(err, &netError) && netError.Timeout()) {
+		return TimeoutError
+	}
+	return OtherError
+}
+
+// boundedValues keeps track of the distinct values of a dimension and maps new values to
+// "Other" once the limit is reached.
+type boundedValues struct {
+	mutex  sync.Mutex
+	max    int
+	values map[string]bool
+}
+
+func newBoundedValues(max int) *boundedValues {
+	return &boundedValues{max: max, values: make(map[string]bool)}
+}
+
+func (b *boundedValues) get(value string) string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.values[value] {
+		return value
+	}
+	if b.max > 0 && len(b.values) >= b.max {
+		return OtherDimensionValue
+	}
+	b.values[value] = true
+	return value
+}
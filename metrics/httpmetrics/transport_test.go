@@ -0,0 +1,224 @@
+package httpmetrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics"
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/testutil"
+)
+
+func newRequestContext() context.Context {
+	logger := testutil.NewLogger(output)
+	logger.SetProperty("RequestId", "abc")
+	return metrics.NewContext(context.Background(), logger)
+}
+
+func TestTransportRecordsCallMetrics(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: NewTransport(nil)}
+	output.Flushed(t)
+
+	req, _ := http.NewRequestWithContext(newRequestContext(), http.MethodPut, server.URL+"/items/42", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	events := output.Flushed(t)
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	expected := map[string]any{
+		"RemoteHost":        "127.0.0.1",
+		"RemoteOperation":   "PUT",
+		"RequestId":         "abc",
+		"OutboundErrors":    []any{0.0},
+		"OutboundStatus5xx": []any{1.0},
+		"OutboundStatus2xx": []any{0.0},
+		"Status5xx":         nil,
+	}
+	for key, value := range expected {
+		if !jsonEqual(events[0][key], value) {
+			t.Errorf("Expected %v for %s, got %v", value, key, events[0][key])
+		}
+	}
+	if _, ok := events[0][OutboundLatencyMetric]; !ok {
+		t.Errorf("Expected latency to be recorded")
+	}
+}
+
+func TestTransportWithConcurrentCallsOnTheRequestLogger(t *testing.T) {
+
+	var barrier sync.WaitGroup
+	barrier.Add(10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		barrier.Done()
+		barrier.Wait()
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: NewTransport(nil)}
+	ctx := newRequestContext()
+	logger := metrics.FromContext(ctx)
+	output.Flushed(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Errorf("Request failed: %v", err)
+				return
+			}
+			resp.Body.Close()
+			logger.PutMetric("Calls", 1, metrics.Count, metrics.StorageResolutionStandard)
+		}()
+	}
+	wg.Wait()
+
+	if events := output.Flushed(t); len(events) != 10 {
+		t.Errorf("Expected 10 events, got %d", len(events))
+	}
+	logger.Flush()
+	events := output.Flushed(t)
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	if calls, ok := events[0]["Calls"].([]any); !ok || len(calls) != 10 {
+		t.Errorf("Expected 10 values for Calls, got %v", events[0]["Calls"])
+	}
+}
+
+func TestTransportRecordsErrorsByType(t *testing.T) {
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closedURL := closed.URL
+	closed.Close()
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+
+	testCases := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{"Connection refused", closedURL, ConnectionRefusedError},
+		{"Timeout", slow.URL, TimeoutError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &http.Client{Transport: NewTransport(nil)}
+			output.Flushed(t)
+
+			ctx, cancel := context.WithTimeout(newRequestContext(), 50*time.Millisecond)
+			defer cancel()
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, tc.url, nil)
+			_, err := client.Do(req)
+			if err == nil {
+				t.Fatalf("Expected error but got nil")
+			}
+
+			events := output.Flushed(t)
+			if len(events) != 1 {
+				t.Fatalf("Expected 1 event, got %d", len(events))
+			}
+			if !jsonEqual(events[0][OutboundErrorsMetric], []any{1.0}) || !jsonEqual(events[0][tc.expected], []any{1.0}) {
+				t.Errorf("Expected a %s to be recorded, got %v", tc.expected, events[0])
+			}
+		})
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+
+	testCases := []struct {
+		err      error
+		expected string
+	}{
+		{&url.Error{Op: "Get", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", IsNotFound: true}}}, DNSError},
+		{&net.OpError{Op: "dial", Err: fmt.Errorf("connect: %w", syscall.ECONNREFUSED)}, ConnectionRefusedError},
+		{fmt.Errorf("call: %w", context.DeadlineExceeded), TimeoutError},
+		{errors.New("unexpected EOF"), OtherError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expected, func(t *testing.T) {
+			if result := classifyError(context.Background(), tc.err); result != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestTransportBoundsDimensionValues(t *testing.T) {
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	client := &http.Client{Transport: NewTransport(nil,
+		WithOperationExtractor(func(r *http.Request) string { return r.URL.Path }),
+		WithAllowedHosts("api.example.com"),
+		WithMaxDimensionValues(2),
+	)}
+	output.Flushed(t)
+
+	for _, path := range []string{"/a", "/b", "/c", "/a"} {
+		req, _ := http.NewRequestWithContext(newRequestContext(), http.MethodGet, server.URL+path, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	events := output.Flushed(t)
+	if len(events) != 4 {
+		t.Fatalf("Expected 4 events, got %d", len(events))
+	}
+	for i, expected := range []string{"/a", "/b", OtherDimensionValue, "/a"} {
+		if events[i][RemoteOperationDimension] != expected {
+			t.Errorf("Expected %v, got %v", expected, events[i][RemoteOperationDimension])
+		}
+		if events[i][RemoteHostDimension] != OtherDimensionValue {
+			t.Errorf("Expected %v, got %v", OtherDimensionValue, events[i][RemoteHostDimension])
+		}
+	}
+}
+
+func TestTransportWithoutRequestLoggerRecordsNothing(t *testing.T) {
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	client := &http.Client{Transport: NewTransport(nil)}
+	output.Flushed(t)
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if events := output.Flushed(t); len(events) != 0 {
+		t.Errorf("Expected no events, got %v", events)
+	}
+}
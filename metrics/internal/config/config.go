@@ -1,7 +1,11 @@
 package config
 
 import (
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/utils"
 )
@@ -25,25 +29,47 @@ const (
 )
 
 type configKeys struct {
-	LOG_GROUP_NAME       string
-	LOG_STREAM_NAME      string
-	ENABLE_DEBUG_LOGGING string
-	SERVICE_NAME         string
-	SERVICE_TYPE         string
-	AGENT_ENDPOINT       string
-	ENVIRONMENT_OVERRIDE string
-	NAMESPACE            string
+	LOG_GROUP_NAME           string
+	LOG_STREAM_NAME          string
+	ENABLE_DEBUG_LOGGING     string
+	SERVICE_NAME             string
+	SERVICE_TYPE             string
+	AGENT_ENDPOINT           string
+	ENVIRONMENT_OVERRIDE     string
+	NAMESPACE                string
+	KUBERNETES_LABELS        string
+	EC2_METADATA_ENDPOINT    string
+	EC2_METADATA_V1_FALLBACK string
+	EC2_INSTANCE_TAGS        string
+	EC2_TAG_DIMENSIONS       string
+	PROBE_ORDER              string
+	DISABLED_PROBES          string
+	DISCOVERY_TIMEOUT        string
+	FLUENT_HOST              string
+	FLUENT_BIT_PORT          string
+	FLUENT_BIT_PROTOCOL      string
 }
 
 var ConfigKeys = configKeys{
-	LOG_GROUP_NAME:       "LOG_GROUP_NAME",
-	LOG_STREAM_NAME:      "LOG_STREAM_NAME",
-	ENABLE_DEBUG_LOGGING: "ENABLE_DEBUG_LOGGING",
-	SERVICE_NAME:         "SERVICE_NAME",
-	SERVICE_TYPE:         "SERVICE_TYPE",
-	AGENT_ENDPOINT:       "AGENT_ENDPOINT",
-	ENVIRONMENT_OVERRIDE: "ENVIRONMENT",
-	NAMESPACE:            "NAMESPACE",
+	LOG_GROUP_NAME:           "LOG_GROUP_NAME",
+	LOG_STREAM_NAME:          "LOG_STREAM_NAME",
+	ENABLE_DEBUG_LOGGING:     "ENABLE_DEBUG_LOGGING",
+	SERVICE_NAME:             "SERVICE_NAME",
+	SERVICE_TYPE:             "SERVICE_TYPE",
+	AGENT_ENDPOINT:           "AGENT_ENDPOINT",
+	ENVIRONMENT_OVERRIDE:     "ENVIRONMENT",
+	NAMESPACE:                "NAMESPACE",
+	KUBERNETES_LABELS:        "KUBERNETES_LABELS",
+	EC2_METADATA_ENDPOINT:    "EC2_METADATA_ENDPOINT",
+	EC2_METADATA_V1_FALLBACK: "EC2_METADATA_V1_FALLBACK",
+	EC2_INSTANCE_TAGS:        "EC2_INSTANCE_TAGS",
+	EC2_TAG_DIMENSIONS:       "EC2_TAG_DIMENSIONS",
+	PROBE_ORDER:              "PROBE_ORDER",
+	DISABLED_PROBES:          "DISABLED_PROBES",
+	DISCOVERY_TIMEOUT:        "DISCOVERY_TIMEOUT",
+	FLUENT_HOST:              "FLUENT_HOST",
+	FLUENT_BIT_PORT:          "FLUENT_BIT_PORT",
+	FLUENT_BIT_PROTOCOL:      "FLUENT_BIT_PROTOCOL",
 }
 
 type Config struct {
@@ -55,21 +81,39 @@ type Config struct {
 	AgentEndpoint           string
 	EnvironmentOverride     utils.Environment
 	Namespace               string
+	KubernetesLabels        []string
+	EC2MetadataEndpoint     string
+	EC2MetadataV1Fallback   bool
+	EC2InstanceTags         bool
+	EC2TagDimensions        []string
+	ProbeOrder              []string
+	DisabledProbes          []string
+	DiscoveryTimeout        time.Duration
+	FluentBitHost           string
+	FluentBitPort           int
+	FluentBitProtocol       string
 }
 
-var environmentConfig = Config{
-	DebuggingLoggingEnabled: tryGetEnvVariableAsBoolean(ConfigKeys.ENABLE_DEBUG_LOGGING, false),
-	ServiceName:             getEnvVar(ConfigKeys.SERVICE_NAME),
-	ServiceType:             getEnvVar(ConfigKeys.SERVICE_TYPE),
-	LogGroupName:            getEnvVar(ConfigKeys.LOG_GROUP_NAME),
-	LogStreamName:           getEnvVar(ConfigKeys.LOG_STREAM_NAME),
-	AgentEndpoint:           getEnvVar(ConfigKeys.AGENT_ENDPOINT),
-	EnvironmentOverride:     getEnvironmentFromOverride(ConfigKeys.ENVIRONMENT_OVERRIDE),
-	Namespace:               getNamespace(ConfigKeys.NAMESPACE),
+// FluentBitEnabled reports whether events are sent to the EMF input of Fluent Bit, which
+// FLUENT_HOST enables. FireLens sets it for the containers of a task, on EKS and other hosts
+// it has to be configured. An explicitly configured AGENT_ENDPOINT takes precedence.
+func (c Config) FluentBitEnabled() bool {
+	return c.FluentBitHost != "" && c.AgentEndpoint == ""
 }
 
+// FluentBitEndpoint returns the endpoint of the Fluent Bit EMF input, e.g.
+// tcp://127.0.0.1:25888, or "" if the Fluent Bit mode is not enabled.
+func (c Config) FluentBitEndpoint() string {
+	if !c.FluentBitEnabled() {
+		return ""
+	}
+	return c.FluentBitProtocol + "://" + net.JoinHostPort(c.FluentBitHost, strconv.Itoa(c.FluentBitPort))
+}
+
+// GetConfig reads the configuration from the environment on every call, so it is safe to
+// call concurrently, e.g. from the environment probes.
 func GetConfig() Config {
-	environmentConfig = Config{
+	return Config{
 		DebuggingLoggingEnabled: tryGetEnvVariableAsBoolean(ConfigKeys.ENABLE_DEBUG_LOGGING, false),
 		ServiceName:             getEnvVar(ConfigKeys.SERVICE_NAME),
 		ServiceType:             getEnvVar(ConfigKeys.SERVICE_TYPE),
@@ -78,8 +122,18 @@ func GetConfig() Config {
 		AgentEndpoint:           getEnvVar(ConfigKeys.AGENT_ENDPOINT),
 		EnvironmentOverride:     getEnvironmentFromOverride(ConfigKeys.ENVIRONMENT_OVERRIDE),
 		Namespace:               getNamespace(ConfigKeys.NAMESPACE),
+		KubernetesLabels:        getEnvVarAsList(ConfigKeys.KUBERNETES_LABELS),
+		EC2MetadataEndpoint:     getEnvVar(ConfigKeys.EC2_METADATA_ENDPOINT),
+		EC2MetadataV1Fallback:   tryGetEnvVariableAsBoolean(ConfigKeys.EC2_METADATA_V1_FALLBACK, false),
+		EC2InstanceTags:         tryGetEnvVariableAsBoolean(ConfigKeys.EC2_INSTANCE_TAGS, false),
+		EC2TagDimensions:        getEnvVarAsList(ConfigKeys.EC2_TAG_DIMENSIONS),
+		ProbeOrder:              getEnvVarAsList(ConfigKeys.PROBE_ORDER),
+		DisabledProbes:          getEnvVarAsList(ConfigKeys.DISABLED_PROBES),
+		DiscoveryTimeout:        getEnvVarAsDuration(ConfigKeys.DISCOVERY_TIMEOUT),
+		FluentBitHost:           getEnvVar(ConfigKeys.FLUENT_HOST),
+		FluentBitPort:           tryGetEnvVariableAsInt(ConfigKeys.FLUENT_BIT_PORT, DEFAULT_AGENT_PORT),
+		FluentBitProtocol:       getFluentBitProtocol(ConfigKeys.FLUENT_BIT_PROTOCOL),
 	}
-	return environmentConfig
 }
 
 func getEnvVar(key string) string {
@@ -97,6 +151,42 @@ func getNamespace(key string) string {
 	return value
 }
 
+// getEnvVarAsList splits a comma separated value and drops empty entries.
+func getEnvVarAsList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnvVar(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvVarAsDuration parses a duration like "500ms" or "2s", invalid values yield 0.
+func getEnvVarAsDuration(key string) time.Duration {
+	value, err := time.ParseDuration(getEnvVar(key))
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+func tryGetEnvVariableAsInt(key string, fallback int) int {
+	value, err := strconv.Atoi(getEnvVar(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func getFluentBitProtocol(key string) string {
+	value := strings.ToLower(getEnvVar(key))
+	if value == "" {
+		return "tcp"
+	}
+	return value
+}
+
 func tryGetEnvVariableAsBoolean(key string, fallback bool) bool {
 	value := getEnvVar(key)
 	if value == "" {
@@ -116,6 +206,12 @@ func getEnvironmentFromOverride(key string) utils.Environment {
 		return utils.Lambda
 	case string(utils.ECS):
 		return utils.ECS
+	case string(utils.EKS):
+		return utils.EKS
+	case string(utils.AppRunner):
+		return utils.AppRunner
+	case string(utils.ElasticBeanstalk):
+		return utils.ElasticBeanstalk
 	case string(utils.Local):
 		return utils.Local
 	default:
@@ -2,7 +2,9 @@ package config
 
 import (
 	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/utils"
 )
@@ -219,3 +221,131 @@ func TestSetNamespace(t *testing.T) {
 	}
 
 }
+
+func TestSetEnvironmentEKS(t *testing.T) {
+
+	os.Setenv("AWS_EMF_ENVIRONMENT", "EKS")
+	defer os.Unsetenv("AWS_EMF_ENVIRONMENT")
+	env := GetConfig()
+	if env.EnvironmentOverride != utils.EKS {
+		t.Errorf("Failed to set environment, expected %s, got %s", utils.EKS, env.EnvironmentOverride)
+	}
+
+}
+
+func TestSetKubernetesLabels(t *testing.T) {
+
+	os.Setenv("AWS_EMF_KUBERNETES_LABELS", "app, team,,tier ")
+	defer os.Unsetenv("AWS_EMF_KUBERNETES_LABELS")
+	env := GetConfig()
+	expectedValue := []string{"app", "team", "tier"}
+	if !reflect.DeepEqual(env.KubernetesLabels, expectedValue) {
+		t.Errorf("Failed to set Kubernetes labels, expected %v, got %v", expectedValue, env.KubernetesLabels)
+	}
+
+}
+
+func TestSetEC2Metadata(t *testing.T) {
+
+	os.Setenv("AWS_EMF_EC2_METADATA_ENDPOINT", "http://[fd00:ec2::254]")
+	os.Setenv("AWS_EMF_EC2_METADATA_V1_FALLBACK", "true")
+	defer os.Unsetenv("AWS_EMF_EC2_METADATA_ENDPOINT")
+	defer os.Unsetenv("AWS_EMF_EC2_METADATA_V1_FALLBACK")
+	env := GetConfig()
+	if env.EC2MetadataEndpoint != "http://[fd00:ec2::254]" {
+		t.Errorf("Failed to set EC2 metadata endpoint, expected %s, got %s", "http://[fd00:ec2::254]", env.EC2MetadataEndpoint)
+	}
+	if !env.EC2MetadataV1Fallback {
+		t.Errorf("Failed to enable IMDSv1 fallback")
+	}
+
+}
+
+func TestSetEnvironmentAppRunnerAndElasticBeanstalk(t *testing.T) {
+
+	defer os.Unsetenv("AWS_EMF_ENVIRONMENT")
+	for _, expectedValue := range []utils.Environment{utils.AppRunner, utils.ElasticBeanstalk} {
+		os.Setenv("AWS_EMF_ENVIRONMENT", string(expectedValue))
+		env := GetConfig()
+		if env.EnvironmentOverride != expectedValue {
+			t.Errorf("Failed to set environment, expected %s, got %s", expectedValue, env.EnvironmentOverride)
+		}
+	}
+
+}
+
+func TestSetProbes(t *testing.T) {
+
+	os.Setenv("AWS_EMF_PROBE_ORDER", "ECS, EC2")
+	os.Setenv("AWS_EMF_DISABLED_PROBES", "Lambda")
+	defer os.Unsetenv("AWS_EMF_PROBE_ORDER")
+	defer os.Unsetenv("AWS_EMF_DISABLED_PROBES")
+	env := GetConfig()
+	if !reflect.DeepEqual(env.ProbeOrder, []string{"ECS", "EC2"}) {
+		t.Errorf("Failed to set probe order, expected %v, got %v", []string{"ECS", "EC2"}, env.ProbeOrder)
+	}
+	if !reflect.DeepEqual(env.DisabledProbes, []string{"Lambda"}) {
+		t.Errorf("Failed to set disabled probes, expected %v, got %v", []string{"Lambda"}, env.DisabledProbes)
+	}
+
+}
+
+func TestSetDiscoveryTimeout(t *testing.T) {
+
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"500ms", 500 * time.Millisecond},
+		{"2s", 2 * time.Second},
+		{"500", 0},
+		{"", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("AWS_EMF_DISCOVERY_TIMEOUT", tt.value)
+			env := GetConfig()
+			if env.DiscoveryTimeout != tt.expected {
+				t.Errorf("Failed to set discovery timeout, expected %v, got %v", tt.expected, env.DiscoveryTimeout)
+			}
+		})
+	}
+
+}
+
+func TestSetFluentBit(t *testing.T) {
+
+	tests := []struct {
+		name             string
+		host             string
+		port             string
+		protocol         string
+		agentEndpoint    string
+		expectedEndpoint string
+	}{
+		{name: "Disabled", expectedEndpoint: ""},
+		{name: "Defaults", host: "127.0.0.1", expectedEndpoint: "tcp://127.0.0.1:25888"},
+		{name: "Configured", host: "fluent-bit.logging", port: "5170", protocol: "UDP", expectedEndpoint: "udp://fluent-bit.logging:5170"},
+		{name: "IPv6", host: "fd00::1", expectedEndpoint: "tcp://[fd00::1]:25888"},
+		{name: "AgentEndpointTakesPrecedence", host: "127.0.0.1", agentEndpoint: "tcp://10.0.0.1:25888", expectedEndpoint: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FLUENT_HOST", tt.host)
+			t.Setenv("AWS_EMF_FLUENT_HOST", "")
+			t.Setenv("AWS_EMF_FLUENT_BIT_PORT", tt.port)
+			t.Setenv("AWS_EMF_FLUENT_BIT_PROTOCOL", tt.protocol)
+			t.Setenv("AWS_EMF_AGENT_ENDPOINT", tt.agentEndpoint)
+			env := GetConfig()
+			if env.FluentBitEndpoint() != tt.expectedEndpoint {
+				t.Errorf("Failed to set Fluent Bit endpoint, expected %s, got %s", tt.expectedEndpoint, env.FluentBitEndpoint())
+			}
+			if env.FluentBitEnabled() != (tt.expectedEndpoint != "") {
+				t.Errorf("Expected Fluent Bit mode %v, got %v", tt.expectedEndpoint != "", env.FluentBitEnabled())
+			}
+		})
+	}
+
+}
@@ -2,9 +2,11 @@ package context
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
+	"sort"
 	"time"
 
 	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/config"
@@ -12,21 +14,34 @@ import (
 )
 
 type MetricsContext struct {
-	Namespace                  string
-	Properties                 map[string]string
+	Namespace  string
+	Properties map[string]any
+	// Metrics are keyed by MetricKey, which is the metric name unless the metric is put
+	// into another namespace with a directive.
 	Metrics                    map[string]MetricsValue
 	Meta                       map[string]any
 	dimensions                 []map[string]string
 	defaultDimensions          map[string]string
 	shouldUseDefaultDimensions bool
+	useEmptyDimensionSet       bool
 	timestamp                  int64
 	metricNameAndResolutionMap map[string]utils.StorageResolution
 }
 
 type MetricsValue struct {
+	Name              string
 	Values            []float64
 	Unit              utils.Unit
 	StorageResolution utils.StorageResolution
+	Directive         *MetricDirective
+}
+
+// MetricDirective publishes a metric under its own dimension sets and/or namespace instead
+// of the ones of the context. Empty fields fall back to the context.
+type MetricDirective struct {
+	Namespace         string
+	Dimensions        []map[string]string
+	EmptyDimensionSet bool
 }
 
 func (m *MetricsValue) addValue(value float64) {
@@ -36,7 +51,7 @@ func (m *MetricsValue) addValue(value float64) {
 func Empty() MetricsContext {
 	return MetricsContext{
 		Namespace:                  config.GetConfig().Namespace,
-		Properties:                 make(map[string]string),
+		Properties:                 make(map[string]any),
 		Metrics:                    make(map[string]MetricsValue),
 		Meta:                       map[string]any{"Timestamp": resolveMetaTimestamp(0)},
 		dimensions:                 make([]map[string]string, 0),
@@ -57,8 +72,15 @@ func (m *MetricsContext) SetNamespace(namespace string) error {
 
 }
 
-func (m *MetricsContext) SetProperty(key string, value string) {
+// SetProperty sets a top level property of the event. The value can be any JSON encodable
+// value, including nested maps, slices and json.Marshaler implementations.
+func (m *MetricsContext) SetProperty(key string, value any) error {
+	err := validateProperty(key, value, m)
+	if err != nil {
+		return err
+	}
 	m.Properties[key] = value
+	return nil
 }
 
 func (m *MetricsContext) SetTimestamp(timestamp int64) error {
@@ -75,11 +97,34 @@ func (m *MetricsContext) SetDefaultDimensions(dimensions map[string]string) {
 	m.defaultDimensions = dimensions
 }
 
+// PutDefaultDimensions adds the given dimensions to the default dimensions.
+func (m *MetricsContext) PutDefaultDimensions(dimensions map[string]string) error {
+	err := validateDimensionSet(dimensions)
+	if err != nil {
+		return err
+	}
+	err = validateDimensionKeys(dimensions, m)
+	if err != nil {
+		return err
+	}
+
+	defaultDimensions := copyDimensionSet(m.defaultDimensions)
+	for key, value := range dimensions {
+		defaultDimensions[key] = value
+	}
+	m.defaultDimensions = defaultDimensions
+	return nil
+}
+
 func (m *MetricsContext) PutDimensions(incomingDimensionSet map[string]string) error {
 	err := validateDimensionSet(incomingDimensionSet)
 	if err != nil {
 		return err
 	}
+	err = validateDimensionKeys(incomingDimensionSet, m)
+	if err != nil {
+		return err
+	}
 
 	incomingDimensionSetKeys := utils.GetMapKeys(incomingDimensionSet)
 
@@ -92,6 +137,10 @@ func (m *MetricsContext) PutDimensions(incomingDimensionSet map[string]string) e
 			filteredDimensions = append(filteredDimensions, existingDimensionSet)
 		}
 	}
+	err = validateDimensionValues(incomingDimensionSet, filteredDimensions, m)
+	if err != nil {
+		return err
+	}
 
 	m.dimensions = append(filteredDimensions, incomingDimensionSet)
 	return nil
@@ -104,37 +153,103 @@ func (m *MetricsContext) SetDimensions(dimensionSets []map[string]string, useDef
 		use = useDefault[0]
 	}
 
-	for _, dimensionSet := range dimensionSets {
+	for i, dimensionSet := range dimensionSets {
 		err := validateDimensionSet(dimensionSet)
 		if err != nil {
 			return err
 		}
+		err = validateDimensionKeys(dimensionSet, m)
+		if err != nil {
+			return err
+		}
+		err = validateDimensionValues(dimensionSet, dimensionSets[:i], m)
+		if err != nil {
+			return err
+		}
 	}
 	m.shouldUseDefaultDimensions = use
+	m.useEmptyDimensionSet = false
 	m.dimensions = dimensionSets
 	return nil
 }
 
 func (m *MetricsContext) ResetDimensions(useDefault bool) {
 	m.shouldUseDefaultDimensions = useDefault
+	m.useEmptyDimensionSet = false
 	m.dimensions = make([]map[string]string, 0)
 }
 
+// LayerDimensions adds the given dimensions to every custom dimension set, or puts them as
+// the only dimension set if there is none yet.
+func (m *MetricsContext) LayerDimensions(dimensions map[string]string) error {
+	err := validateDimensionSet(dimensions)
+	if err != nil {
+		return err
+	}
+	err = validateDimensionKeys(dimensions, m)
+	if err != nil {
+		return err
+	}
+	err = validateDimensionValues(dimensions, nil, m)
+	if err != nil {
+		return err
+	}
+
+	if len(m.dimensions) == 0 {
+		m.dimensions = []map[string]string{copyDimensionSet(dimensions)}
+		return nil
+	}
+
+	layeredDimensions := make([]map[string]string, 0, len(m.dimensions))
+	for _, dimensionSet := range m.dimensions {
+		layeredDimensions = append(layeredDimensions, utils.MergeMaps(dimensionSet, dimensions).(map[string]string))
+	}
+	m.dimensions = layeredDimensions
+	return nil
+}
+
+// PutEmptyDimensionSet publishes the metrics additionally without any dimensions, which
+// is serialized as an empty dimension set. The empty set is never merged with the default
+// dimensions.
+func (m *MetricsContext) PutEmptyDimensionSet() {
+	m.useEmptyDimensionSet = true
+}
+
+func (m *MetricsContext) ShouldUseDefaultDimensions() bool {
+	return m.shouldUseDefaultDimensions
+}
+
 func (m *MetricsContext) GetDimensions() []map[string]string {
+	return appendEmptyDimensionSet(m.mergeDefaultDimensions(m.dimensions), m.useEmptyDimensionSet)
+}
+
+func appendEmptyDimensionSet(dimensionSets []map[string]string, useEmptyDimensionSet bool) []map[string]string {
+	if !useEmptyDimensionSet {
+		return dimensionSets
+	}
+	for _, dimensionSet := range dimensionSets {
+		if len(dimensionSet) == 0 {
+			return dimensionSets
+		}
+	}
+	return append(append(make([]map[string]string, 0, len(dimensionSets)+1), dimensionSets...), map[string]string{})
+}
+
+func (m *MetricsContext) mergeDefaultDimensions(dimensionSets []map[string]string) []map[string]string {
 	if !m.shouldUseDefaultDimensions {
-		return m.dimensions
+		return dimensionSets
 	}
 
 	if len(m.defaultDimensions) == 0 {
-		return m.dimensions
+		return dimensionSets
 	}
 
-	if len(m.dimensions) == 0 {
+	if len(dimensionSets) == 0 {
 		return []map[string]string{m.defaultDimensions}
 	}
 
 	mergedDimensions := make([]map[string]string, 0)
-	for _, customDimension := range m.dimensions {
+	for _, customDimension := range dimensionSets {
 		m := utils.MergeMaps(m.defaultDimensions, customDimension)
 		if m == nil {
 			log.Println("Merged dimensions are empty")
@@ -149,26 +264,62 @@ func (m *MetricsContext) PutMetric(key string, value float64, unit utils.Unit, s
 	if len(storageResolution) >= 1 {
 		sR = storageResolution[0]
 	}
+	return m.PutMetricWithDirective(key, value, unit, sR, nil)
+}
+
+// MetricKey returns the key of a metric in Metrics. Metrics put into a namespace with a
+// directive are keyed by namespace and name, so one name can be used in several namespaces.
+func MetricKey(name string, directive *MetricDirective) string {
+	if directive == nil || directive.Namespace == "" {
+		return name
+	}
+	return directive.Namespace + "\x00" + name
+}
 
-	err := validateMetric(key, unit, sR, m.metricNameAndResolutionMap)
+// PutMetricWithDirective puts a metric that is published under the dimension sets and
+// namespace of the given directive. A nil directive uses the ones of the context.
+func (m *MetricsContext) PutMetricWithDirective(key string, value float64, unit utils.Unit, storageResolution utils.StorageResolution, directive *MetricDirective) error {
+	metricKey := MetricKey(key, directive)
+	err := validateMetric(key, unit, storageResolution, m.metricNameAndResolutionMap[metricKey])
 	if err != nil {
 		return err
 	}
-	currentMetric := m.Metrics[key]
+	if _, exists := m.Properties[key]; exists {
+		return errors.New("metric key " + key + " is already used by a property")
+	}
+	if directive != nil {
+		err = validateDirective(key, directive, m)
+		if err != nil {
+			return err
+		}
+	}
+
+	currentMetric := m.Metrics[metricKey]
 	if currentMetric.Values != nil && currentMetric.Unit != "" && currentMetric.StorageResolution != 0 {
+		if !areDirectivesEqual(currentMetric.Directive, directive) {
+			return errors.New("metric " + key + " is already published under other dimensions or another namespace")
+		}
+		value, err = convertToDeclaredUnit(key, value, unit, currentMetric.Unit)
+		if err != nil {
+			return err
+		}
 		currentMetric.addValue(value)
-		m.Metrics[key] = currentMetric
+		m.Metrics[metricKey] = currentMetric
 	} else {
-		m.Metrics[key] = MetricsValue{
+		m.Metrics[metricKey] = MetricsValue{
+			Name:              key,
 			Values:            []float64{value},
 			Unit:              unit,
-			StorageResolution: sR,
+			StorageResolution: storageResolution,
+			Directive:         directive,
 		}
 	}
-	m.metricNameAndResolutionMap[key] = sR
+	m.metricNameAndResolutionMap[metricKey] = storageResolution
 	return nil
 }
 
+// CreateCopyWithContext creates a new context without metrics. Properties and dimensions
+// are copied, so changing them on the copy does not affect the original context.
 func (m *MetricsContext) CreateCopyWithContext(preserveDimensions ...bool) MetricsContext {
 
 	pD := true
@@ -176,19 +327,41 @@ func (m *MetricsContext) CreateCopyWithContext(preserveDimensions ...bool) Metri
 		pD = preserveDimensions[0]
 	}
 
+	properties := make(map[string]any, len(m.Properties))
+	for key, value := range m.Properties {
+		properties[key] = value
+	}
+	dimensions := make([]map[string]string, 0, len(m.dimensions))
+	for _, dimensionSet := range m.dimensions {
+		dimensions = append(dimensions, copyDimensionSet(dimensionSet))
+	}
+	var defaultDimensions map[string]string
+	if m.defaultDimensions != nil {
+		defaultDimensions = copyDimensionSet(m.defaultDimensions)
+	}
+
 	return MetricsContext{
 		Namespace:                  m.Namespace,
-		Properties:                 m.Properties,
+		Properties:                 properties,
 		Metrics:                    make(map[string]MetricsValue),
 		Meta:                       map[string]any{"Timestamp": resolveMetaTimestamp(0)},
-		dimensions:                 m.dimensions,
-		defaultDimensions:          m.defaultDimensions,
+		dimensions:                 dimensions,
+		defaultDimensions:          defaultDimensions,
 		shouldUseDefaultDimensions: pD,
+		useEmptyDimensionSet:       m.useEmptyDimensionSet,
 		timestamp:                  m.timestamp,
 		metricNameAndResolutionMap: make(map[string]utils.StorageResolution),
 	}
 }
 
+func copyDimensionSet(dimensionSet map[string]string) map[string]string {
+	copied := make(map[string]string, len(dimensionSet))
+	for key, value := range dimensionSet {
+		copied[key] = value
+	}
+	return copied
+}
+
 func resolveMetaTimestamp(timestamp int64) int64 {
 	if timestamp == 0 {
 		return time.Now().Unix() * 1000
@@ -196,98 +369,211 @@ func resolveMetaTimestamp(timestamp int64) int64 {
 	return timestamp
 }
 
-func (m *MetricsContext) Serialize() ([]string, error) {
+// metricGroup holds the metrics that share a namespace and dimension sets, which are
+// serialized as one directive of the CloudWatchMetrics array.
+type metricGroup struct {
+	key             string
+	namespace       string
+	dimensionKeys   [][]string
+	dimensionValues map[string]string
+}
+
+// metricEvent holds the metrics serialized into the same log events. A dimension has a
+// single value per event and the values of a metric are stored under its name, so groups
+// with conflicting dimension values and metrics with the same name in several namespaces
+// go into separate events.
+type metricEvent struct {
+	keys            []string
+	names           map[string]bool
+	dimensionValues map[string]string
+}
+
+func (m *MetricsContext) groupMetrics() (map[string]metricGroup, error) {
+	groups := make(map[string]metricGroup)
+
+	for key, metric := range m.Metrics {
+		namespace := m.Namespace
+		dimensionSets := m.GetDimensions()
+		if metric.Directive != nil {
+			if metric.Directive.Namespace != "" {
+				namespace = metric.Directive.Namespace
+			}
+			if metric.Directive.Dimensions != nil {
+				dimensionSets = m.mergeDefaultDimensions(metric.Directive.Dimensions)
+			}
+			dimensionSets = appendEmptyDimensionSet(dimensionSets, metric.Directive.EmptyDimensionSet)
+		}
 
-	var dimensionKeys [][]string
-	dimensionProperties := make(map[string]string)
+		// an event without dimension sets has to serialize as [] instead of null
+		dimensionKeys := make([][]string, 0, len(dimensionSets))
+		dimensionValues := make(map[string]string)
+		for _, dimensionSet := range dimensionSets {
+			keys := utils.GetMapKeys(dimensionSet)
 
-	for _, dimensionSet := range m.GetDimensions() {
-		keys := utils.GetMapKeys(dimensionSet)
+			if len(keys) > utils.MAX_DIMENSION_SET_SIZE {
+				return nil, fmt.Errorf("maximum number of dimensions allowed is %d", utils.MAX_DIMENSION_SET_SIZE)
+			}
 
-		if len(keys) > utils.MAX_DIMENSION_SET_SIZE {
-			return nil, fmt.Errorf("maximum number of dimensions allowed is %d", utils.MAX_DIMENSION_SET_SIZE)
+			sort.Strings(keys)
+			dimensionKeys = append(dimensionKeys, keys)
+			for k, v := range dimensionSet {
+				if existing, exists := dimensionValues[k]; exists && existing != v {
+					log.Printf("Dimension %s of metric %s has conflicting values %s and %s, serializing %s", k, metric.Name, existing, v, existing)
+					continue
+				}
+				dimensionValues[k] = v
+			}
 		}
 
-		dimensionKeys = append(dimensionKeys, keys)
-		for k, v := range dimensionSet {
-			dimensionProperties[k] = v
+		// the key is JSON encoded, so dimension keys containing separators cannot collide
+		groupKey, err := json.Marshal([]interface{}{namespace, dimensionKeys})
+		if err != nil {
+			return nil, err
 		}
+		groups[key] = metricGroup{key: string(groupKey), namespace: namespace, dimensionKeys: dimensionKeys, dimensionValues: dimensionValues}
 	}
+	return groups, nil
+}
 
-	// Function to create the base structure for the JSON object
-	createBody := func() map[string]interface{} {
-		return map[string]interface{}{
-			"_aws": map[string]interface{}{
-				"Timestamp": m.Meta["Timestamp"],
-				"CloudWatchMetrics": []map[string]interface{}{
-					{
-						"Namespace":  m.Namespace,
-						"Dimensions": dimensionKeys,
-						"Metrics":    []interface{}{},
-					},
-				},
-			},
+// splitEvents assigns the metrics to events in the given order. A metric goes into the
+// first event its dimension values do not conflict with and that has no metric of the
+// same name.
+func (m *MetricsContext) splitEvents(keys []string, groups map[string]metricGroup) []metricEvent {
+	events := []metricEvent{}
+	for _, key := range keys {
+		group := groups[key]
+		name := m.Metrics[key].Name
+		index := -1
+		for i, event := range events {
+			if !event.names[name] && !hasConflictingValues(event.dimensionValues, group.dimensionValues) {
+				index = i
+				break
+			}
+		}
+		if index == -1 {
+			index = len(events)
+			events = append(events, metricEvent{names: make(map[string]bool), dimensionValues: make(map[string]string)})
+		}
+		events[index].names[name] = true
+		for k, v := range group.dimensionValues {
+			events[index].dimensionValues[k] = v
 		}
+		events[index].keys = append(events[index].keys, key)
 	}
+	return events
+}
 
-	eventBatches := []string{}
-	currentBody := createBody()
+func hasConflictingValues(a, b map[string]string) bool {
+	for k, v := range b {
+		if existing, exists := a[k]; exists && existing != v {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MetricsContext) Serialize() ([]string, error) {
 
-	// adding dimensionProperties to the current body
-	for k, v := range dimensionProperties {
-		currentBody[k] = v
+	groups, err := m.groupMetrics()
+	if err != nil {
+		return nil, err
 	}
 
-	// Function to serialize and add the current body to the batches
-	serializeCurrentBody := func() {
-		bodyBytes, err := json.Marshal(currentBody)
-		if err != nil {
-			log.Println("Error serializing JSON:", err)
-			return
+	// Function to create the base structure for the JSON object
+	createBody := func(dimensionValues map[string]string) map[string]interface{} {
+		body := make(map[string]interface{})
+		// properties are added first, so they can never overwrite dimension values or metrics
+		for k, v := range m.Properties {
+			body[k] = v
+		}
+		for k, v := range dimensionValues {
+			body[k] = v
+		}
+		meta := map[string]interface{}{
+			"Timestamp":         m.Meta["Timestamp"],
+			"CloudWatchMetrics": []map[string]interface{}{},
 		}
-		eventBatches = append(eventBatches, string(bodyBytes))
-		currentBody = createBody()
+		// set by the agent sink, the agent writes the event to this log group and stream
+		for _, key := range []string{"LogGroupName", "LogStreamName"} {
+			if value, ok := m.Meta[key]; ok && value != "" {
+				meta[key] = value
+			}
+		}
+		body["_aws"] = meta
+		return body
 	}
 
-	// Iterate over the metrics to add them to the event batches
-	for key, metric := range m.Metrics {
-		// Add metrics in batches, ensuring they don’t exceed limits
-		for i := 0; i < len(metric.Values); i += utils.MAX_VALUES_PER_METRIC {
-			end := int(math.Min(float64(i+utils.MAX_VALUES_PER_METRIC), float64(len(metric.Values))))
-			valueSlice := metric.Values[i:end]
-
-			currentBody[key] = valueSlice
-			metricObj := map[string]interface{}{
-				"Name":              key,
-				"Unit":              string(metric.Unit),
-				"StorageResolution": metric.StorageResolution,
+	keys := make([]string, 0, len(m.Metrics))
+	for key := range m.Metrics {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	eventBatches := []string{}
+	for _, event := range m.splitEvents(keys, groups) {
+		currentBody := createBody(event.dimensionValues)
+		// index of each group's directive in the CloudWatchMetrics array of the current body
+		directiveIndex := make(map[string]int)
+		metricsInBody := make(map[string]bool)
+
+		// Function to serialize and add the current body to the batches
+		serializeCurrentBody := func() {
+			bodyBytes, err := json.Marshal(currentBody)
+			if err != nil {
+				log.Println("Error serializing JSON:", err)
+				return
 			}
-			// Only add the metric object if it doesn't already exist
-			existingMetrics := currentBody["_aws"].(map[string]interface{})["CloudWatchMetrics"].([]map[string]interface{})[0]["Metrics"].([]interface{})
-			metricExists := false
-			for _, metric := range existingMetrics {
-				if metric.(map[string]interface{})["Name"] == key {
-					metricExists = true
-					break
+			eventBatches = append(eventBatches, string(bodyBytes))
+			currentBody = createBody(event.dimensionValues)
+			directiveIndex = make(map[string]int)
+			metricsInBody = make(map[string]bool)
+		}
+
+		// Iterate over the metrics to add them to the event batches
+		for _, key := range event.keys {
+			metric := m.Metrics[key]
+			group := groups[key]
+			// Add metrics in batches, ensuring they don’t exceed limits
+			for i := 0; i < len(metric.Values); i += utils.MAX_VALUES_PER_METRIC {
+				end := int(math.Min(float64(i+utils.MAX_VALUES_PER_METRIC), float64(len(metric.Values))))
+				valueSlice := metric.Values[i:end]
+
+				aws := currentBody["_aws"].(map[string]interface{})
+				directives := aws["CloudWatchMetrics"].([]map[string]interface{})
+				index, exists := directiveIndex[group.key]
+				if !exists {
+					index = len(directives)
+					directiveIndex[group.key] = index
+					directives = append(directives, map[string]interface{}{
+						"Namespace":  group.namespace,
+						"Dimensions": group.dimensionKeys,
+						"Metrics":    []interface{}{},
+					})
+					aws["CloudWatchMetrics"] = directives
 				}
-			}
-			if !metricExists {
-				currentBody["_aws"].(map[string]interface{})["CloudWatchMetrics"].([]map[string]interface{})[0]["Metrics"] = append(
-					currentBody["_aws"].(map[string]interface{})["CloudWatchMetrics"].([]map[string]interface{})[0]["Metrics"].([]interface{}),
-					metricObj,
-				)
-			}
 
-			// If we hit the max number of metrics per event, serialize the current batch
-			if len(currentBody["_aws"].(map[string]interface{})["CloudWatchMetrics"].([]map[string]interface{})[0]["Metrics"].([]interface{})) == utils.MAX_METRICS_PER_EVENT {
-				serializeCurrentBody()
+				// Only add the metric object if it doesn't already exist
+				if !metricsInBody[key] {
+					directives[index]["Metrics"] = append(directives[index]["Metrics"].([]interface{}), map[string]interface{}{
+						"Name":              metric.Name,
+						"Unit":              string(metric.Unit),
+						"StorageResolution": metric.StorageResolution,
+					})
+					metricsInBody[key] = true
+				}
+				currentBody[metric.Name] = valueSlice
+
+				// If we hit the max number of metrics per event, serialize the current batch
+				if len(metricsInBody) == utils.MAX_METRICS_PER_EVENT {
+					serializeCurrentBody()
+				}
 			}
 		}
-	}
 
-	// Serialize the remaining body if there are unprocessed metrics
-	if len(currentBody["_aws"].(map[string]interface{})["CloudWatchMetrics"].([]map[string]interface{})[0]["Metrics"].([]interface{})) > 0 {
-		serializeCurrentBody()
+		// Serialize the remaining body if there are unprocessed metrics
+		if len(metricsInBody) > 0 {
+			serializeCurrentBody()
+		}
 	}
 
 	return eventBatches, nil
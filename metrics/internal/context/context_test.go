@@ -1,10 +1,13 @@
 package context
 
 import (
+	"encoding/json"
 	"fmt"
 	"math"
 	"math/rand"
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -128,6 +131,131 @@ func TestCanSetProperty(t *testing.T) {
 	}
 }
 
+func TestSetPropertySerializesStructuredValues(t *testing.T) {
+
+	context := Empty()
+	context.PutMetric("Latency", 1, utils.Milliseconds)
+	context.SetProperty("Count", 3)
+	context.SetProperty("Cached", true)
+	context.SetProperty("Tags", []string{"a", "b"})
+	context.SetProperty("Request", map[string]any{"Path": "/", "Attempt": 2})
+	context.SetProperty("Time", time.Unix(0, 0).UTC())
+
+	batches, err := context.Serialize()
+	if err != nil {
+		t.Fatalf("Serialization failed: %v", err)
+	}
+
+	var event map[string]any
+	if err := json.Unmarshal([]byte(batches[0]), &event); err != nil {
+		t.Fatalf("Failed to parse event: %v", err)
+	}
+	if event["Count"] != 3.0 || event["Cached"] != true || event["Time"] != "1970-01-01T00:00:00Z" {
+		t.Errorf("Expected scalar properties, got %v", event)
+	}
+	if fmt.Sprint(event["Tags"]) != "[a b]" {
+		t.Errorf("Expected %v, got %v", "[a b]", event["Tags"])
+	}
+	if event["Request"].(map[string]any)["Attempt"] != 2.0 {
+		t.Errorf("Expected nested property, got %v", event["Request"])
+	}
+}
+
+func TestSetPropertyIsSerializedInEveryBatch(t *testing.T) {
+
+	context := Empty()
+	context.SetProperty("RequestId", "abc")
+	for i := 0; i < 150; i++ {
+		context.PutMetric("Metric"+strconv.Itoa(i), 1, utils.Count)
+	}
+
+	batches, _ := context.Serialize()
+	for _, batch := range batches {
+		var event map[string]any
+		json.Unmarshal([]byte(batch), &event)
+		if event["RequestId"] != "abc" {
+			t.Errorf("Expected %v, got %v", "abc", event["RequestId"])
+		}
+	}
+}
+
+func TestSetPropertyWithCollidingKeyThrowsError(t *testing.T) {
+
+	context := Empty()
+	context.PutMetric("Latency", 1, utils.Milliseconds)
+	context.PutDimensions(map[string]string{"Operation": "Get"})
+	context.SetDefaultDimensions(map[string]string{"ServiceName": "svc"})
+
+	testCases := []struct {
+		name  string
+		key   string
+		value any
+	}{
+		{"Reserved key", "_aws", "value"},
+		{"Metric name", "Latency", 1},
+		{"Dimension key", "Operation", "Put"},
+		{"Default dimension key", "ServiceName", "other"},
+		{"Reserved default dimension key", "LogGroup", "other"},
+		{"Empty key", " ", "value"},
+		{"Unencodable value", "Channel", make(chan int)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := context.SetProperty(tc.key, tc.value)
+			if err == nil {
+				t.Errorf("Expected error but got nil")
+			}
+		})
+	}
+
+	if len(context.Properties) != 0 {
+		t.Errorf("Expected no properties, got %v", context.Properties)
+	}
+}
+
+func TestPutDimensionsWithPropertyKeyThrowsError(t *testing.T) {
+
+	context := Empty()
+	context.SetProperty("Operation", "Get")
+
+	testCases := []struct {
+		name string
+		put  func(dimensions map[string]string) error
+	}{
+		{"PutDimensions", context.PutDimensions},
+		{"SetDimensions", func(dimensions map[string]string) error {
+			return context.SetDimensions([]map[string]string{dimensions})
+		}},
+		{"LayerDimensions", context.LayerDimensions},
+		{"PutDefaultDimensions", context.PutDefaultDimensions},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.put(map[string]string{"Operation": "Put"})
+			if err == nil {
+				t.Errorf("Expected error but got nil")
+			}
+		})
+	}
+
+	if len(context.GetDimensions()) != 0 {
+		t.Errorf("Expected no dimensions, got %v", context.GetDimensions())
+	}
+}
+
+func TestPutMetricWithPropertyKeyThrowsError(t *testing.T) {
+
+	context := Empty()
+	context.SetProperty("Latency", "slow")
+
+	err := context.PutMetric("Latency", 1, utils.Milliseconds)
+	if err == nil {
+		t.Errorf("Expected error but got nil")
+	}
+}
+
 func TestSetDimensionsAllows30Dimensions(t *testing.T) {
 
 	context := Empty()
@@ -374,6 +502,405 @@ func TestPutMetricUsesStandardStorageResolutionIfNotProvided(t *testing.T) {
 	}
 }
 
+func TestPutMetricConvertsValueIntoDeclaredUnit(t *testing.T) {
+
+	testCases := []struct {
+		declaredUnit utils.Unit
+		unit         utils.Unit
+		value        float64
+		expected     float64
+	}{
+		{utils.Milliseconds, utils.Seconds, 1.5, 1500},
+		{utils.Seconds, utils.Microseconds, 250000, 0.25},
+		{utils.Bytes, utils.Kilobytes, 2, 2048},
+		{utils.Megabits, utils.Kilobits, 500, 0.5},
+		{utils.KilobytesPerSecond, utils.BytesPerSecond, 512, 0.5},
+		{utils.Count, utils.Count, 3, 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("Convert %s to %s", tc.unit, tc.declaredUnit), func(t *testing.T) {
+			context := Empty()
+			context.PutMetric("key", 1, tc.declaredUnit)
+			err := context.PutMetric("key", tc.value, tc.unit)
+			if err != nil {
+				t.Fatalf("Expected nil but got error %v", err)
+			}
+
+			metricDatum := context.Metrics["key"]
+			if metricDatum.Unit != tc.declaredUnit {
+				t.Errorf("Expected %v, got %v", tc.declaredUnit, metricDatum.Unit)
+			}
+			if metricDatum.Values[1] != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, metricDatum.Values[1])
+			}
+		})
+	}
+}
+
+func TestPutMetricWithIncompatibleUnitThrowsError(t *testing.T) {
+
+	testCases := []struct {
+		declaredUnit utils.Unit
+		unit         utils.Unit
+	}{
+		{utils.Count, utils.Seconds},
+		{utils.Bytes, utils.Bits},
+		{utils.Bytes, utils.BytesPerSecond},
+		{utils.None, utils.Percent},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("Mix %s with %s", tc.declaredUnit, tc.unit), func(t *testing.T) {
+			context := Empty()
+			context.PutMetric("key", 1, tc.declaredUnit)
+			err := context.PutMetric("key", 2, tc.unit)
+			if err == nil {
+				t.Errorf("Expected error but got nil")
+			}
+			if len(context.Metrics["key"].Values) != 1 {
+				t.Errorf("Expected %v, got %v", 1, len(context.Metrics["key"].Values))
+			}
+		})
+	}
+}
+
+func TestSerializeMetricsWithDirectivesIntoSeparateDirectives(t *testing.T) {
+
+	context := Empty()
+	context.SetDefaultDimensions(map[string]string{"ServiceName": "svc"})
+	context.PutDimensions(map[string]string{"Operation": "Get"})
+	context.PutMetric("Requests", 1, utils.Count)
+	directive := &MetricDirective{Dimensions: []map[string]string{{"Operation": "Get", "Customer": "c1"}}}
+	context.PutMetricWithDirective("Latency", 10, utils.Milliseconds, utils.Standard, directive)
+	context.PutMetricWithDirective("Size", 10, utils.Bytes, utils.Standard, &MetricDirective{Dimensions: []map[string]string{{"Customer": "c1", "Operation": "Get"}}})
+
+	batches, err := context.Serialize()
+	if err != nil {
+		t.Fatalf("Serialization failed: %v", err)
+	}
+	if len(batches) != 1 {
+		t.Fatalf("Expected 1 batch, but got %d", len(batches))
+	}
+
+	event := parseEvent(t, batches[0])
+	directives := event.AWS.CloudWatchMetrics
+	if len(directives) != 2 {
+		t.Fatalf("Expected 2 directives, but got %d", len(directives))
+	}
+	expected := map[string][][]string{
+		"Latency,Size": {{"Customer", "Operation", "ServiceName"}},
+		"Requests":     {{"Operation", "ServiceName"}},
+	}
+	for _, directive := range directives {
+		names := make([]string, 0)
+		for _, metric := range directive.Metrics {
+			names = append(names, metric.Name)
+		}
+		key := strings.Join(names, ",")
+		if fmt.Sprint(directive.Dimensions) != fmt.Sprint(expected[key]) {
+			t.Errorf("Expected %v for %s, got %v", expected[key], key, directive.Dimensions)
+		}
+	}
+	if event.Values["Customer"] != "c1" || event.Values["Operation"] != "Get" || event.Values["ServiceName"] != "svc" {
+		t.Errorf("Expected dimension values in the event, got %v", event.Values)
+	}
+}
+
+func TestPutMetricWithDirectiveWithConflictingDimensionValueThrowsError(t *testing.T) {
+
+	context := Empty()
+	context.PutDimensions(map[string]string{"Operation": "Get"})
+
+	err := context.PutMetricWithDirective("Latency", 1, utils.Milliseconds, utils.Standard, &MetricDirective{Dimensions: []map[string]string{{"Operation": "Put"}}})
+	if err == nil {
+		t.Errorf("Expected error but got nil")
+	}
+}
+
+func TestPutMetricWithDirectiveWithConflictingDimensionSetsThrowsError(t *testing.T) {
+
+	context := Empty()
+
+	err := context.PutMetricWithDirective("Latency", 1, utils.Milliseconds, utils.Standard, &MetricDirective{Dimensions: []map[string]string{{"Operation": "a"}, {"Operation": "b"}}})
+	if err == nil {
+		t.Errorf("Expected error but got nil")
+	}
+}
+
+func TestPutMetricWithDirectiveWithOtherDirectiveThrowsError(t *testing.T) {
+
+	context := Empty()
+	context.PutMetricWithDirective("Latency", 1, utils.Milliseconds, utils.Standard, &MetricDirective{Dimensions: []map[string]string{{"Operation": "Get"}}})
+
+	err := context.PutMetricWithDirective("Latency", 2, utils.Milliseconds, utils.Standard, &MetricDirective{Dimensions: []map[string]string{{"Customer": "c1"}}})
+	if err == nil {
+		t.Errorf("Expected error but got nil")
+	}
+
+	err = context.PutMetric("Latency", 3, utils.Milliseconds)
+	if err == nil {
+		t.Errorf("Expected error but got nil")
+	}
+	if len(context.Metrics["Latency"].Values) != 1 {
+		t.Errorf("Expected %v, got %v", 1, len(context.Metrics["Latency"].Values))
+	}
+}
+
+func TestPutMetricWithDirectiveOnMetricWithoutDirectiveThrowsError(t *testing.T) {
+
+	context := Empty()
+	context.PutMetric("Latency", 1, utils.Milliseconds)
+
+	err := context.PutMetricWithDirective("Latency", 2, utils.Milliseconds, utils.Standard, &MetricDirective{Dimensions: []map[string]string{{"Operation": "Get"}}})
+	if err == nil {
+		t.Errorf("Expected error but got nil")
+	}
+}
+
+func TestPutDimensionsAfterMetricWithConflictingDimensionValueThrowsError(t *testing.T) {
+
+	context := Empty()
+	context.PutMetricWithDirective("A", 1, utils.Count, utils.Standard, &MetricDirective{Dimensions: []map[string]string{{"Operation": "x"}}})
+
+	err := context.PutDimensions(map[string]string{"Operation": "y"})
+	if err == nil {
+		t.Errorf("Expected error but got nil")
+	}
+	err = context.SetDimensions([]map[string]string{{"Operation": "y"}})
+	if err == nil {
+		t.Errorf("Expected error but got nil")
+	}
+	err = context.LayerDimensions(map[string]string{"Operation": "y"})
+	if err == nil {
+		t.Errorf("Expected error but got nil")
+	}
+	err = context.PutDimensions(map[string]string{"Operation": "x"})
+	if err != nil {
+		t.Errorf("Expected nil but got error %v", err)
+	}
+
+	context.PutMetric("B", 1, utils.Count)
+	batches, err := context.Serialize()
+	if err != nil {
+		t.Fatalf("Serialization failed: %v", err)
+	}
+	if len(batches) != 1 {
+		t.Errorf("Expected 1 batch, but got %d", len(batches))
+	}
+}
+
+func TestSetDimensionsWithConflictingDimensionValuesThrowsError(t *testing.T) {
+
+	context := Empty()
+
+	err := context.SetDimensions([]map[string]string{{"Operation": "x"}, {"Operation": "y", "Customer": "c1"}})
+	if err == nil {
+		t.Errorf("Expected error but got nil")
+	}
+}
+
+func TestSerializeSplitsConflictingDimensionValuesIntoSeparateEvents(t *testing.T) {
+
+	context := Empty()
+	context.SetDefaultDimensions(map[string]string{"ServiceName": "svc"})
+	context.PutMetric("Requests", 1, utils.Count)
+	context.PutMetricWithDirective("Latency", 10, utils.Milliseconds, utils.Standard, &MetricDirective{Dimensions: []map[string]string{{"ServiceName": "other"}}})
+
+	batches, err := context.Serialize()
+	if err != nil {
+		t.Fatalf("Serialization failed: %v", err)
+	}
+	if len(batches) != 2 {
+		t.Fatalf("Expected 2 batches, but got %d", len(batches))
+	}
+
+	expected := map[string]string{"Latency": "other", "Requests": "svc"}
+	for _, batch := range batches {
+		event := parseEvent(t, batch)
+		name := event.AWS.CloudWatchMetrics[0].Metrics[0].Name
+		if event.Values["ServiceName"] != expected[name] {
+			t.Errorf("Expected %v for %s, got %v", expected[name], name, event.Values["ServiceName"])
+		}
+	}
+}
+
+func TestSerializeDoesNotMergeDirectivesWithSeparatorsInDimensionKeys(t *testing.T) {
+
+	context := Empty()
+	context.PutMetricWithDirective("A", 1, utils.Count, utils.Standard, &MetricDirective{Dimensions: []map[string]string{{"a,b": "1"}}})
+	context.PutMetricWithDirective("B", 1, utils.Count, utils.Standard, &MetricDirective{Dimensions: []map[string]string{{"a": "1", "b": "1"}}})
+
+	batches, err := context.Serialize()
+	if err != nil {
+		t.Fatalf("Serialization failed: %v", err)
+	}
+
+	event := parseEvent(t, batches[0])
+	if len(event.AWS.CloudWatchMetrics) != 2 {
+		t.Errorf("Expected 2 directives, but got %d", len(event.AWS.CloudWatchMetrics))
+	}
+}
+
+func TestSerializeGroupsMetricsByNamespace(t *testing.T) {
+
+	context := Empty()
+	context.SetNamespace("Payments/API")
+	context.PutMetric("Requests", 1, utils.Count)
+	context.PutMetricWithDirective("Score", 1, utils.None, utils.Standard, &MetricDirective{Namespace: "Payments/Fraud"})
+
+	batches, err := context.Serialize()
+	if err != nil {
+		t.Fatalf("Serialization failed: %v", err)
+	}
+
+	event := parseEvent(t, batches[0])
+	if len(event.AWS.CloudWatchMetrics) != 2 {
+		t.Fatalf("Expected 2 directives, but got %d", len(event.AWS.CloudWatchMetrics))
+	}
+	for _, directive := range event.AWS.CloudWatchMetrics {
+		expected := map[string]string{"Requests": "Payments/API", "Score": "Payments/Fraud"}[directive.Metrics[0].Name]
+		if directive.Namespace != expected {
+			t.Errorf("Expected %v, got %v", expected, directive.Namespace)
+		}
+	}
+}
+
+func TestPutMetricWithDirectiveValidatesNamespace(t *testing.T) {
+
+	context := Empty()
+
+	err := context.PutMetricWithDirective("Score", 1, utils.None, utils.Standard, &MetricDirective{Namespace: "Invalid Namespace!"})
+	if err == nil {
+		t.Errorf("Expected error but got nil")
+	}
+}
+
+func TestSerializeEmptyDimensionSet(t *testing.T) {
+
+	testCases := []struct {
+		name     string
+		setup    func(context *MetricsContext)
+		expected string
+	}{
+		{"Only empty dimension set", func(context *MetricsContext) {
+			context.ResetDimensions(false)
+			context.PutEmptyDimensionSet()
+		}, "[[]]"},
+		{"Empty dimension set next to other sets", func(context *MetricsContext) {
+			context.PutDimensions(map[string]string{"Operation": "Get"})
+			context.PutEmptyDimensionSet()
+		}, "[[Operation ServiceName] []]"},
+		{"Empty dimension set next to default dimensions", func(context *MetricsContext) {
+			context.PutEmptyDimensionSet()
+		}, "[[ServiceName] []]"},
+		{"Empty dimension set is not duplicated", func(context *MetricsContext) {
+			context.ResetDimensions(false)
+			context.PutDimensions(map[string]string{})
+			context.PutEmptyDimensionSet()
+		}, "[[]]"},
+		{"No dimension sets", func(context *MetricsContext) {
+			context.ResetDimensions(false)
+		}, "[]"},
+		{"Reset removes empty dimension set", func(context *MetricsContext) {
+			context.PutEmptyDimensionSet()
+			context.ResetDimensions(false)
+		}, "[]"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			context := Empty()
+			context.SetDefaultDimensions(map[string]string{"ServiceName": "svc"})
+			tc.setup(&context)
+			context.PutMetric("Requests", 1, utils.Count)
+
+			batches, err := context.Serialize()
+			if err != nil {
+				t.Fatalf("Serialization failed: %v", err)
+			}
+
+			event := parseEvent(t, batches[0])
+			dimensions := event.Values["_aws"].(map[string]any)["CloudWatchMetrics"].([]any)[0].(map[string]any)["Dimensions"]
+			if dimensions == nil {
+				t.Fatalf("Expected %v, got null", tc.expected)
+			}
+			if fmt.Sprint(dimensions) != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, dimensions)
+			}
+		})
+	}
+}
+
+func TestSerializeDirectiveWithEmptyDimensionSet(t *testing.T) {
+
+	context := Empty()
+	context.ResetDimensions(false)
+	context.PutMetricWithDirective("Requests", 1, utils.Count, utils.Standard, &MetricDirective{
+		Dimensions:        []map[string]string{{"Operation": "Get"}},
+		EmptyDimensionSet: true,
+	})
+
+	batches, err := context.Serialize()
+	if err != nil {
+		t.Fatalf("Serialization failed: %v", err)
+	}
+
+	event := parseEvent(t, batches[0])
+	if fmt.Sprint(event.AWS.CloudWatchMetrics[0].Dimensions) != "[[Operation] []]" {
+		t.Errorf("Expected %v, got %v", "[[Operation] []]", event.AWS.CloudWatchMetrics[0].Dimensions)
+	}
+}
+
+func TestSerializeCountsMetricsOfAllDirectivesTowardsTheLimit(t *testing.T) {
+
+	context := Empty()
+	for i := 0; i < 60; i++ {
+		context.PutMetric("Metric"+strconv.Itoa(i), 1, utils.Count)
+		context.PutMetricWithDirective("Grouped"+strconv.Itoa(i), 1, utils.Count, utils.Standard, &MetricDirective{Dimensions: []map[string]string{{"Group": "g"}}})
+	}
+
+	batches, err := context.Serialize()
+	if err != nil {
+		t.Fatalf("Serialization failed: %v", err)
+	}
+	if len(batches) != 2 {
+		t.Fatalf("Expected 2 batches, but got %d", len(batches))
+	}
+	for _, batch := range batches {
+		event := parseEvent(t, batch)
+		count := 0
+		for _, directive := range event.AWS.CloudWatchMetrics {
+			count += len(directive.Metrics)
+		}
+		if count > utils.MAX_METRICS_PER_EVENT {
+			t.Errorf("Expected at most %d metrics, got %d", utils.MAX_METRICS_PER_EVENT, count)
+		}
+	}
+}
+
+type serializedEvent struct {
+	AWS struct {
+		CloudWatchMetrics []struct {
+			Namespace  string
+			Dimensions [][]string
+			Metrics    []struct{ Name string }
+		}
+	} `json:"_aws"`
+	Values map[string]any `json:"-"`
+}
+
+func parseEvent(t *testing.T, batch string) serializedEvent {
+	var event serializedEvent
+	if err := json.Unmarshal([]byte(batch), &event); err != nil {
+		t.Fatalf("Failed to parse event: %v", err)
+	}
+	if err := json.Unmarshal([]byte(batch), &event.Values); err != nil {
+		t.Fatalf("Failed to parse event: %v", err)
+	}
+	return event
+}
+
 func TestCreateCopyWithContextCopiesPropertiesAndDimensions(t *testing.T) {
 
 	context := Empty()
@@ -387,6 +914,62 @@ func TestCreateCopyWithContextCopiesPropertiesAndDimensions(t *testing.T) {
 	}
 }
 
+func TestCreateCopyWithContextDoesNotShareState(t *testing.T) {
+
+	context := Empty()
+	context.PutDimensions(map[string]string{"Key": "Value"})
+	context.SetDefaultDimensions(map[string]string{"ServiceName": "svc"})
+	context.SetProperty("Prop", "Value")
+
+	newContext := context.CreateCopyWithContext()
+	newContext.SetProperty("Other", "Value")
+	newContext.PutDimensions(map[string]string{"Other": "Value"})
+	newContext.dimensions[0]["Key"] = "Changed"
+	newContext.defaultDimensions["ServiceName"] = "changed"
+
+	if len(context.Properties) != 1 {
+		t.Errorf("Expected %v, got %v", 1, len(context.Properties))
+	}
+	if len(context.dimensions) != 1 || context.dimensions[0]["Key"] != "Value" {
+		t.Errorf("Expected %v, got %v", []map[string]string{{"Key": "Value"}}, context.dimensions)
+	}
+	if context.defaultDimensions["ServiceName"] != "svc" {
+		t.Errorf("Expected %v, got %v", "svc", context.defaultDimensions["ServiceName"])
+	}
+}
+
+func TestLayerDimensionsAddsDimensionsToEverySet(t *testing.T) {
+
+	context := Empty()
+	context.PutDimensions(map[string]string{"Service": "api"})
+	context.PutDimensions(map[string]string{"Service": "api", "Region": "eu"})
+
+	err := context.LayerDimensions(map[string]string{"Operation": "Get"})
+	if err != nil {
+		t.Fatalf("Expected nil but got error %v", err)
+	}
+
+	expected := []map[string]string{
+		{"Service": "api", "Operation": "Get"},
+		{"Service": "api", "Region": "eu", "Operation": "Get"},
+	}
+	if !utils.AreArrayMapsEqual(expected, context.GetDimensions()) {
+		t.Errorf("Expected %v, got %v", expected, context.GetDimensions())
+	}
+}
+
+func TestLayerDimensionsWithoutDimensionSetsPutsDimensions(t *testing.T) {
+
+	context := Empty()
+
+	context.LayerDimensions(map[string]string{"Operation": "Get"})
+
+	expected := []map[string]string{{"Operation": "Get"}}
+	if !utils.AreArrayMapsEqual(expected, context.GetDimensions()) {
+		t.Errorf("Expected %v, got %v", expected, context.GetDimensions())
+	}
+}
+
 /*
  *	func TestCreateCopyWithContextCopiesShouldUseDefaultDimensions(t *testing.T) {
  *
@@ -628,7 +1211,7 @@ func TestSetValidTimestamp(t *testing.T) {
 	testCases := []struct {
 		timestamp int64
 	}{
-		{1728121252},
+		{time.Now().Unix()},
 		{time.Now().Add(-utils.MAX_TIMESTAMP_PAST_AGE).Unix() + 1000},
 		{time.Now().Add(utils.MAX_TIMESTAMP_FUTURE_AGE).Unix() - 1000},
 	}
@@ -660,7 +1243,7 @@ func areContextsEqual(a, b MetricsContext) bool {
 	if a.Namespace != b.Namespace {
 		return false
 	}
-	if !utils.AreMapsEqual(a.Properties, b.Properties) {
+	if !utils.AreMapsAnyEqual(a.Properties, b.Properties) {
 		return false
 	}
 	if !areMapsMetricsValueEqual(a.Metrics, b.Metrics) {
@@ -701,3 +1284,62 @@ func areMapsMetricsValueEqual(map1, map2 map[string]MetricsValue) bool {
 
 	return true
 }
+
+func TestPutDefaultDimensionsAddsToDefaultDimensions(t *testing.T) {
+
+	defaultDimensions := map[string]string{"ServiceName": "svc"}
+	context := Empty()
+	context.SetDefaultDimensions(defaultDimensions)
+
+	if err := context.PutDefaultDimensions(map[string]string{"Team": "payments"}); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if err := context.PutDefaultDimensions(map[string]string{"Team": ""}); err == nil {
+		t.Errorf("Expected an error for an invalid dimension value")
+	}
+
+	expected := []map[string]string{{"ServiceName": "svc", "Team": "payments"}}
+	if dimensions := context.GetDimensions(); !reflect.DeepEqual(dimensions, expected) {
+		t.Errorf("Expected %v, got %v", expected, dimensions)
+	}
+	if len(defaultDimensions) != 1 {
+		t.Errorf("Expected the given default dimensions not to be modified, got %v", defaultDimensions)
+	}
+}
+
+// TestSerializeLogGroupAndStream ensures that the log group and stream set by the agent sink are written to the metadata.
+func TestSerializeLogGroupAndStream(t *testing.T) {
+	m := Empty()
+	m.PutMetric("Metric", 1.0, utils.Milliseconds)
+	m.Meta["LogGroupName"] = "checkout-metrics"
+	m.Meta["LogStreamName"] = "web"
+
+	batches, err := m.Serialize()
+	if err != nil {
+		t.Fatalf("Serialization failed: %v", err)
+	}
+
+	var event struct {
+		Aws map[string]any `json:"_aws"`
+	}
+	if err := json.Unmarshal([]byte(batches[0]), &event); err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	if event.Aws["LogGroupName"] != "checkout-metrics" || event.Aws["LogStreamName"] != "web" {
+		t.Errorf("Expected the log group and stream in the metadata, got %v", event.Aws)
+	}
+}
+
+// TestSerializeWithoutLogGroup ensures that no log group is written if none is set.
+func TestSerializeWithoutLogGroup(t *testing.T) {
+	m := Empty()
+	m.PutMetric("Metric", 1.0, utils.Milliseconds)
+
+	batches, err := m.Serialize()
+	if err != nil {
+		t.Fatalf("Serialization failed: %v", err)
+	}
+	if strings.Contains(batches[0], "LogGroupName") || strings.Contains(batches[0], "LogStreamName") {
+		t.Errorf("Expected no log group or stream, got %s", batches[0])
+	}
+}
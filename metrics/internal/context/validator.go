@@ -1,6 +1,7 @@
 package context
 
 import (
+	"encoding/json"
 	"errors"
 	"strconv"
 	"strings"
@@ -22,6 +23,126 @@ func validateNamespace(namespace string) error {
 	return nil
 }
 
+func validateProperty(key string, value any, m *MetricsContext) error {
+	if strings.TrimSpace(key) == "" {
+		return errors.New("property key " + key + " must include at least one non-whitespace character")
+	}
+	if key == "_aws" {
+		return errors.New("property key _aws is reserved for the metadata of the event")
+	}
+	for _, metric := range m.Metrics {
+		if metric.Name == key {
+			return errors.New("property key " + key + " is already used by a metric")
+		}
+	}
+	if _, exists := m.defaultDimensions[key]; exists {
+		return errors.New("property key " + key + " is already used by a dimension")
+	}
+	for _, defaultKey := range utils.DEFAULT_DIMENSION_KEYS {
+		if key == defaultKey {
+			return errors.New("property key " + key + " is reserved for a default dimension")
+		}
+	}
+	if _, exists := dimensionValue(key, m); exists {
+		return errors.New("property key " + key + " is already used by a dimension")
+	}
+	if _, err := json.Marshal(value); err != nil {
+		return errors.New("property value for key " + key + " cannot be encoded as JSON: " + err.Error())
+	}
+	return nil
+}
+
+func validateDirective(key string, directive *MetricDirective, m *MetricsContext) error {
+	if directive.Namespace != "" {
+		err := validateNamespace(directive.Namespace)
+		if err != nil {
+			return err
+		}
+	}
+	for i, dimensionSet := range directive.Dimensions {
+		err := validateDimensionSet(dimensionSet)
+		if err != nil {
+			return err
+		}
+		err = validateDimensionValues(dimensionSet, directive.Dimensions[:i], m)
+		if err != nil {
+			return err
+		}
+		for k, v := range dimensionSet {
+			if _, exists := m.Properties[k]; exists {
+				return errors.New("dimension key " + k + " of metric " + key + " is already used by a property")
+			}
+			if existing, ok := dimensionValue(k, m); ok && existing != v {
+				return errors.New("dimension " + k + " of metric " + key + " is already set to " + existing + ". A single log event cannot have a dimension with two different values.")
+			}
+		}
+	}
+	return nil
+}
+
+// validateDimensionKeys checks that no key of the dimension set is already used by a
+// property, which the dimension value would overwrite in the serialized event.
+func validateDimensionKeys(dimensionSet map[string]string, m *MetricsContext) error {
+	for k := range dimensionSet {
+		if _, exists := m.Properties[k]; exists {
+			return errors.New("dimension key " + k + " is already used by a property")
+		}
+	}
+	return nil
+}
+
+// validateDimensionValues checks that the dimension set does not give a dimension another
+// value than the given dimension sets or the dimensions of metrics put with a directive.
+func validateDimensionValues(dimensionSet map[string]string, dimensionSets []map[string]string, m *MetricsContext) error {
+	for k, v := range dimensionSet {
+		existing, ok := lookupDimensionValue(k, dimensionSets)
+		if !ok {
+			existing, ok = directiveDimensionValue(k, m)
+		}
+		if ok && existing != v {
+			return errors.New("dimension " + k + " is already set to " + existing + ". A single log event cannot have a dimension with two different values.")
+		}
+	}
+	return nil
+}
+
+// dimensionValue looks up the value of a dimension key in the custom dimensions of the
+// context and in the dimensions of metrics put with a directive.
+func dimensionValue(key string, m *MetricsContext) (string, bool) {
+	if value, ok := lookupDimensionValue(key, m.dimensions); ok {
+		return value, true
+	}
+	return directiveDimensionValue(key, m)
+}
+
+func lookupDimensionValue(key string, dimensionSets []map[string]string) (string, bool) {
+	for _, dimensionSet := range dimensionSets {
+		if value, ok := dimensionSet[key]; ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func directiveDimensionValue(key string, m *MetricsContext) (string, bool) {
+	for _, metric := range m.Metrics {
+		if metric.Directive == nil {
+			continue
+		}
+		if value, ok := lookupDimensionValue(key, metric.Directive.Dimensions); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func areDirectivesEqual(a, b *MetricDirective) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Namespace == b.Namespace && a.EmptyDimensionSet == b.EmptyDimensionSet && utils.AreArrayMapsEqual(a.Dimensions, b.Dimensions)
+}
+
 func validateDimensionSet(dimensionSet map[string]string) error {
 
 	if len(dimensionSet) > utils.MAX_DIMENSION_SET_SIZE {
@@ -58,7 +179,7 @@ func validateDimensionSet(dimensionSet map[string]string) error {
 	return nil
 }
 
-func validateMetric(key string, unit utils.Unit, storageResolution utils.StorageResolution, metricNameAndResolutionMap map[string]utils.StorageResolution) error {
+func validateMetric(key string, unit utils.Unit, storageResolution utils.StorageResolution, declaredResolution utils.StorageResolution) error {
 
 	if len(strings.TrimSpace(key)) == 0 {
 		return errors.New("metric key " + key + "must include at least one non-whitespace character")
@@ -72,13 +193,23 @@ func validateMetric(key string, unit utils.Unit, storageResolution utils.Storage
 	if storageResolution != utils.High && storageResolution != utils.Standard {
 		return errors.New("storage resolution " + strconv.Itoa(int(storageResolution)) + " is not a valid")
 	}
-	if metricNameAndResolutionMap[key] != 0 && metricNameAndResolutionMap[key] != storageResolution {
+	if declaredResolution != 0 && declaredResolution != storageResolution {
 		return errors.New("resolution for metrics " + key + " is already set. A single log event cannot have a metric with two different resolutions.")
 	}
 
 	return nil
 }
 
+func convertToDeclaredUnit(key string, value float64, unit utils.Unit, declaredUnit utils.Unit) (float64, error) {
+	if unit == declaredUnit {
+		return value, nil
+	}
+	if !utils.AreUnitsCompatible(unit, declaredUnit) {
+		return 0, errors.New("unit " + string(unit) + " for metric " + key + " is not compatible with the declared unit " + string(declaredUnit) + ". A single metric cannot mix units of different kinds.")
+	}
+	return utils.ConvertUnit(value, unit, declaredUnit)
+}
+
 func isValidUnit(unit utils.Unit) bool {
 	for _, u := range utils.Units {
 		if u == unit {
@@ -0,0 +1,83 @@
+package environments
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/config"
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/context"
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/sinks"
+)
+
+const appRunnerServiceArnEnvVar = "AWS_APP_RUNNER_SERVICE_ARN"
+
+// AppRunnerEnvironment writes to stdout, which App Runner forwards to the application log
+// group of the service. Not every App Runner runtime exposes the service ARN, so the
+// environment can also be selected with AWS_EMF_ENVIRONMENT=AppRunner.
+type AppRunnerEnvironment struct {
+	sinkCache
+}
+
+func (e *AppRunnerEnvironment) Probe() bool {
+	return os.Getenv(appRunnerServiceArnEnvVar) != ""
+}
+
+// ProbeError tells why the probe fails.
+func (e *AppRunnerEnvironment) ProbeError() error {
+	return errors.New(appRunnerServiceArnEnvVar + " is not set")
+}
+
+func (e *AppRunnerEnvironment) GetName() string {
+	env := config.GetConfig()
+	if env.ServiceName != "" {
+		return env.ServiceName
+	}
+	if name := appRunnerServiceName(os.Getenv(appRunnerServiceArnEnvVar)); name != "" {
+		return name
+	}
+	return "Unknown"
+}
+
+func (e *AppRunnerEnvironment) GetType() string {
+	return "AWS::AppRunner::Service"
+}
+
+func (e *AppRunnerEnvironment) GetLogGroupName() string {
+	env := config.GetConfig()
+	if env.LogGroupName != "" {
+		return env.LogGroupName
+	}
+	return e.GetName() + "-metrics"
+}
+
+func (e *AppRunnerEnvironment) ConfigureContext(ctx *context.MetricsContext) {
+	e.addProperty(ctx, "serviceArn", os.Getenv(appRunnerServiceArnEnvVar))
+	e.addProperty(ctx, "region", os.Getenv("AWS_REGION"))
+	if hostname, err := os.Hostname(); err == nil {
+		e.addProperty(ctx, "instanceId", hostname)
+	}
+}
+
+func (e *AppRunnerEnvironment) GetSink() sinks.Sink {
+	return e.getSink(func() sinks.Sink {
+		return sinks.NewConsoleSink()
+	})
+}
+
+func (e *AppRunnerEnvironment) addProperty(ctx *context.MetricsContext, key, value string) {
+	if value != "" {
+		ctx.SetProperty(key, value)
+	}
+}
+
+// appRunnerServiceName returns the name of a service ARN of the form
+// arn:aws:apprunner:<region>:<account>:service/<name>/<id>.
+func appRunnerServiceName(serviceArn string) string {
+	_, resource, found := strings.Cut(serviceArn, ":service/")
+	if !found {
+		return ""
+	}
+	name, _, _ := strings.Cut(resource, "/")
+	return name
+}
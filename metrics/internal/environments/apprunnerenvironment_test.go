@@ -0,0 +1,79 @@
+package environments
+
+import (
+	"testing"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/context"
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/sinks"
+)
+
+const testServiceArn = "arn:aws:apprunner:us-east-1:123456789012:service/checkout/8fe1e10304f84fd2b0df550fe98a71fa"
+
+func setAppRunnerEnv(t *testing.T, serviceArn string) {
+	t.Setenv(appRunnerServiceArnEnvVar, serviceArn)
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("SERVICE_NAME", "")
+	t.Setenv("AWS_EMF_SERVICE_NAME", "")
+	t.Setenv("LOG_GROUP_NAME", "")
+	t.Setenv("AWS_EMF_LOG_GROUP_NAME", "")
+}
+
+func TestAppRunnerEnvironmentProbe(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		serviceArn string
+		expected   bool
+	}{
+		{name: "AppRunner", serviceArn: testServiceArn, expected: true},
+		{name: "NotAppRunner", serviceArn: "", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setAppRunnerEnv(t, tt.serviceArn)
+			env := &AppRunnerEnvironment{}
+			if result := env.Probe(); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestAppRunnerEnvironment(t *testing.T) {
+
+	setAppRunnerEnv(t, testServiceArn)
+	env := &AppRunnerEnvironment{}
+
+	if env.GetName() != "checkout" {
+		t.Errorf("Expected %v, got %v", "checkout", env.GetName())
+	}
+	if env.GetType() != "AWS::AppRunner::Service" {
+		t.Errorf("Expected %v, got %v", "AWS::AppRunner::Service", env.GetType())
+	}
+	if env.GetLogGroupName() != "checkout-metrics" {
+		t.Errorf("Expected %v, got %v", "checkout-metrics", env.GetLogGroupName())
+	}
+	if _, ok := env.GetSink().(*sinks.ConsoleSink); !ok {
+		t.Errorf("Expected a console sink, got %T", env.GetSink())
+	}
+
+	ctx := context.Empty()
+	env.ConfigureContext(&ctx)
+	if ctx.Properties["serviceArn"] != testServiceArn {
+		t.Errorf("Expected %v, got %v", testServiceArn, ctx.Properties["serviceArn"])
+	}
+	if ctx.Properties["region"] != "us-east-1" {
+		t.Errorf("Expected %v, got %v", "us-east-1", ctx.Properties["region"])
+	}
+}
+
+func TestAppRunnerEnvironmentWithoutServiceArn(t *testing.T) {
+
+	setAppRunnerEnv(t, "")
+	env := &AppRunnerEnvironment{}
+
+	if env.GetName() != "Unknown" {
+		t.Errorf("Expected %v, got %v", "Unknown", env.GetName())
+	}
+}
@@ -0,0 +1,126 @@
+package environments
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/config"
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/context"
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/sinks"
+)
+
+const (
+	beanstalkConfigPathLinux   = "/var/elasticbeanstalk/xray/environment.conf"
+	beanstalkConfigPathWindows = `C:\Program Files\Amazon\XRay\environment.conf`
+)
+
+// BeanstalkMetadata is the environment configuration Elastic Beanstalk writes to every
+// instance of an environment.
+type BeanstalkMetadata struct {
+	DeploymentId    int    `json:"deployment_id"`
+	VersionLabel    string `json:"version_label"`
+	EnvironmentName string `json:"environment_name"`
+}
+
+// BeanstalkEnvironment detects Elastic Beanstalk instances, which run the CloudWatch agent,
+// from the environment configuration file.
+type BeanstalkEnvironment struct {
+	sinkCache
+	metadata   *BeanstalkMetadata
+	configPath string
+	probeErr   error
+	mutex      sync.Mutex
+}
+
+func NewBeanstalkEnvironment() (*BeanstalkEnvironment, error) {
+	beanstalk := &BeanstalkEnvironment{}
+	if !beanstalk.Probe() {
+		return nil, errors.New("failed to probe Elastic Beanstalk environment")
+	}
+	return beanstalk, nil
+}
+
+func (e *BeanstalkEnvironment) Probe() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	content, err := os.ReadFile(e.getConfigPath())
+	if err != nil {
+		e.probeErr = err
+		return false
+	}
+
+	metadata := &BeanstalkMetadata{}
+	if err := json.Unmarshal(content, metadata); err != nil {
+		log.Println("Error decoding Elastic Beanstalk environment configuration:", err)
+		e.probeErr = err
+		return false
+	}
+	e.metadata = metadata
+	e.probeErr = nil
+	return true
+}
+
+// ProbeError tells why the last probe failed.
+func (e *BeanstalkEnvironment) ProbeError() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.probeErr
+}
+
+func (e *BeanstalkEnvironment) GetName() string {
+	env := config.GetConfig()
+	if env.ServiceName != "" {
+		return env.ServiceName
+	}
+	if e.metadata != nil && e.metadata.EnvironmentName != "" {
+		return e.metadata.EnvironmentName
+	}
+	return "Unknown"
+}
+
+func (e *BeanstalkEnvironment) GetType() string {
+	return "AWS::ElasticBeanstalk::Environment"
+}
+
+func (e *BeanstalkEnvironment) GetLogGroupName() string {
+	return agentLogGroupName(e.GetName() + "-metrics")
+}
+
+func (e *BeanstalkEnvironment) ConfigureContext(ctx *context.MetricsContext) {
+	if e.metadata == nil {
+		return
+	}
+	e.addProperty(ctx, "environmentName", e.metadata.EnvironmentName)
+	e.addProperty(ctx, "versionLabel", e.metadata.VersionLabel)
+	if e.metadata.DeploymentId != 0 {
+		ctx.SetProperty("deploymentId", e.metadata.DeploymentId)
+	}
+}
+
+func (e *BeanstalkEnvironment) GetSink() sinks.Sink {
+	return e.getSink(func() sinks.Sink {
+		env := config.GetConfig()
+		return sinks.NewAgentSink(e.GetLogGroupName(), env.LogStreamName)
+	})
+}
+
+func (e *BeanstalkEnvironment) addProperty(ctx *context.MetricsContext, key, value string) {
+	if value != "" {
+		ctx.SetProperty(key, value)
+	}
+}
+
+func (e *BeanstalkEnvironment) getConfigPath() string {
+	if e.configPath != "" {
+		return e.configPath
+	}
+	if runtime.GOOS == "windows" {
+		return beanstalkConfigPathWindows
+	}
+	return beanstalkConfigPathLinux
+}
@@ -0,0 +1,80 @@
+package environments
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/context"
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/sinks"
+)
+
+func newTestBeanstalkEnvironment(t *testing.T, content string) *BeanstalkEnvironment {
+	path := filepath.Join(t.TempDir(), "environment.conf")
+	if content != "" {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	t.Setenv("SERVICE_NAME", "")
+	t.Setenv("AWS_EMF_SERVICE_NAME", "")
+	t.Setenv("LOG_GROUP_NAME", "")
+	t.Setenv("AWS_EMF_LOG_GROUP_NAME", "")
+	return &BeanstalkEnvironment{configPath: path}
+}
+
+func TestBeanstalkEnvironmentProbe(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		content  string
+		expected bool
+	}{
+		{name: "Beanstalk", content: `{"deployment_id":23,"version_label":"v1.2.3","environment_name":"shop-prod"}`, expected: true},
+		{name: "InvalidConfiguration", content: `not json`, expected: false},
+		{name: "NotBeanstalk", content: "", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestBeanstalkEnvironment(t, tt.content)
+			if result := env.Probe(); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestBeanstalkEnvironment(t *testing.T) {
+
+	env := newTestBeanstalkEnvironment(t, `{"deployment_id":23,"version_label":"v1.2.3","environment_name":"shop-prod"}`)
+	if !env.Probe() {
+		t.Fatalf("Expected probe to succeed")
+	}
+
+	if env.GetName() != "shop-prod" {
+		t.Errorf("Expected %v, got %v", "shop-prod", env.GetName())
+	}
+	if env.GetType() != "AWS::ElasticBeanstalk::Environment" {
+		t.Errorf("Expected %v, got %v", "AWS::ElasticBeanstalk::Environment", env.GetType())
+	}
+	if env.GetLogGroupName() != "shop-prod-metrics" {
+		t.Errorf("Expected %v, got %v", "shop-prod-metrics", env.GetLogGroupName())
+	}
+	if _, ok := env.GetSink().(*sinks.AgentSink); !ok {
+		t.Errorf("Expected an agent sink, got %T", env.GetSink())
+	}
+
+	ctx := context.Empty()
+	env.ConfigureContext(&ctx)
+	expected := map[string]any{
+		"environmentName": "shop-prod",
+		"versionLabel":    "v1.2.3",
+		"deploymentId":    23,
+	}
+	for key, value := range expected {
+		if ctx.Properties[key] != value {
+			t.Errorf("Expected %s to be %v, got %v", key, value, ctx.Properties[key])
+		}
+	}
+}
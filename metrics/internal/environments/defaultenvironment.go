@@ -7,7 +7,7 @@ import (
 )
 
 type DefaultEnvironment struct {
-	sink sinks.Sink
+	sinkCache
 }
 
 func (e *DefaultEnvironment) Probe() bool {
@@ -31,11 +31,7 @@ func (e *DefaultEnvironment) GetType() string {
 }
 
 func (e *DefaultEnvironment) GetLogGroupName() string {
-	env := config.GetConfig()
-	if env.LogGroupName == "" {
-		return e.GetName() + "-metrics"
-	}
-	return env.LogGroupName
+	return agentLogGroupName(e.GetName() + "-metrics")
 }
 
 func (e *DefaultEnvironment) ConfigureContext(ctx *context.MetricsContext) {
@@ -43,9 +39,8 @@ func (e *DefaultEnvironment) ConfigureContext(ctx *context.MetricsContext) {
 }
 
 func (e *DefaultEnvironment) GetSink() sinks.Sink {
-	env := config.GetConfig()
-	if e.sink == nil {
-		e.sink = sinks.NewAgentSink(e.GetLogGroupName(), env.LogStreamName)
-	}
-	return e.sink
+	return e.getSink(func() sinks.Sink {
+		env := config.GetConfig()
+		return sinks.NewAgentSink(e.GetLogGroupName(), env.LogStreamName)
+	})
 }
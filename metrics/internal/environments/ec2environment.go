@@ -1,12 +1,11 @@
 package environments
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
+	"net/url"
+	"strings"
 	"sync"
 
 	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/config"
@@ -14,12 +13,12 @@ import (
 	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/sinks"
 )
 
-const host = "169.254.169.254"
-const tokenPath = "/latest/api/token"
-const tokenRequestHeaderKey = "X-aws-ec2-metadata-token-ttl-seconds"
-const tokenRequestHeaderValue = "21600"
-const metadataPath = "/latest/dynamic/instance-identity/document"
-const metadataRequestTokenHeaderKey = "X-aws-ec2-metadata-token"
+const (
+	metadataPath        = "/latest/dynamic/instance-identity/document"
+	lifeCyclePath       = "/latest/meta-data/instance-life-cycle"
+	tagsPath            = "/latest/meta-data/tags/instance"
+	autoScalingGroupTag = "aws:autoscaling:groupName"
+)
 
 type EC2MetadataResponse struct {
 	ImageId          string `json:"imageId"`
@@ -27,13 +26,19 @@ type EC2MetadataResponse struct {
 	PrivateIp        string `json:"privateIp"`
 	InstanceId       string `json:"instanceId"`
 	InstanceType     string `json:"instanceType"`
+	Region           string `json:"region"`
+	AccountId        string `json:"accountId"`
 }
 
 type EC2Environment struct {
+	sinkCache
 	metadata *EC2MetadataResponse
-	sink     sinks.Sink
-	token    string
-	mutex    sync.Mutex
+	// lifeCycle is "on-demand", "spot" or "scheduled".
+	lifeCycle string
+	tags      map[string]string
+	imds      *IMDSClient
+	probeErr  error
+	mutex     sync.Mutex
 }
 
 func NewEC2Environment() (*EC2Environment, error) {
@@ -48,69 +53,65 @@ func (e *EC2Environment) Probe() bool {
 	e.mutex.Lock()
 	defer e.mutex.Unlock()
 
-	// Fetch token
-	token, err := e.fetchToken()
-	if err != nil {
-		log.Println("Error fetching token:", err)
-		return false
-	}
-	e.token = token
+	// a new client on every probe, so a probe after a reset uses the current config and
+	// does not reuse the token of the previous one
+	e.imds = NewIMDSClient()
+	e.metadata = nil
+	e.lifeCycle = ""
+	e.tags = nil
 
-	// Fetch metadata
-	metadata, err := e.fetchMetadata(token)
-	if err != nil {
+	var metadata EC2MetadataResponse
+	if err := e.imds.GetJSON(metadataPath, &metadata); err != nil {
 		log.Println("Error fetching metadata:", err)
+		e.probeErr = err
 		return false
 	}
-	e.metadata = metadata
-
-	return e.metadata != nil
-}
+	e.metadata = &metadata
+	e.probeErr = nil
 
-// Fetch token from EC2 metadata service
-func (e *EC2Environment) fetchToken() (string, error) {
-	req, err := http.NewRequest("PUT", fmt.Sprintf("http://%s%s", host, tokenPath), nil)
-	if err != nil {
-		return "", err
+	if lifeCycle, err := e.imds.Get(lifeCyclePath); err == nil {
+		e.lifeCycle = string(lifeCycle)
 	}
-	req.Header.Set(tokenRequestHeaderKey, tokenRequestHeaderValue)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
+	env := config.GetConfig()
+	if env.EC2InstanceTags || len(env.EC2TagDimensions) > 0 {
+		tags, err := e.fetchTags()
+		if err != nil {
+			log.Println("Error fetching instance tags, make sure access to tags in instance metadata is enabled:", err)
+		}
+		e.tags = tags
 	}
-	defer resp.Body.Close()
 
-	tokenBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-	return string(tokenBytes), nil
+	return true
 }
 
-// Fetch EC2 instance metadata
-func (e *EC2Environment) fetchMetadata(token string) (*EC2MetadataResponse, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("http://%s%s", host, metadataPath), nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set(metadataRequestTokenHeaderKey, token)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// fetchTags reads the instance tags, which are only available if access to tags in
+// instance metadata is enabled for the instance.
+func (e *EC2Environment) fetchTags() (map[string]string, error) {
+	keys, err := e.imds.Get(tagsPath)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	var metadata EC2MetadataResponse
-	err = json.NewDecoder(resp.Body).Decode(&metadata)
-	if err != nil {
-		return nil, err
+	tags := make(map[string]string)
+	for _, key := range strings.Split(strings.TrimSpace(string(keys)), "\n") {
+		if key == "" {
+			continue
+		}
+		value, err := e.imds.Get(tagsPath + "/" + url.PathEscape(key))
+		if err != nil {
+			return tags, err
+		}
+		tags[key] = string(value)
 	}
+	return tags, nil
+}
 
-	return &metadata, nil
+// ProbeError tells why the last probe failed.
+func (e *EC2Environment) ProbeError() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.probeErr
 }
 
 // GetName returns the service name or "Unknown" if not configured.
@@ -133,14 +134,11 @@ func (e *EC2Environment) GetType() string {
 
 // GetLogGroupName returns the log group name.
 func (e *EC2Environment) GetLogGroupName() string {
-	env := config.GetConfig()
-	if env.LogGroupName != "" {
-		return env.LogGroupName
-	}
-	return fmt.Sprintf("%s-metrics", e.GetName())
+	return agentLogGroupName(fmt.Sprintf("%s-metrics", e.GetName()))
 }
 
-// ConfigureContext adds EC2 metadata to the provided MetricsContext.
+// ConfigureContext adds EC2 metadata to the provided MetricsContext. Instance tags listed
+// in EC2_TAG_DIMENSIONS are added to the default dimensions.
 func (e *EC2Environment) ConfigureContext(ctx *context.MetricsContext) {
 	if e.metadata != nil {
 		ctx.SetProperty("imageId", e.metadata.ImageId)
@@ -148,14 +146,40 @@ func (e *EC2Environment) ConfigureContext(ctx *context.MetricsContext) {
 		ctx.SetProperty("instanceType", e.metadata.InstanceType)
 		ctx.SetProperty("privateIP", e.metadata.PrivateIp)
 		ctx.SetProperty("availabilityZone", e.metadata.AvailabilityZone)
+		e.addProperty(ctx, "region", e.metadata.Region)
+		e.addProperty(ctx, "accountId", e.metadata.AccountId)
+	}
+	e.addProperty(ctx, "instanceLifeCycle", e.lifeCycle)
+	e.addProperty(ctx, "autoScalingGroup", e.tags[autoScalingGroupTag])
+
+	env := config.GetConfig()
+	if env.EC2InstanceTags && len(e.tags) > 0 {
+		ctx.SetProperty("tags", e.tags)
+	}
+
+	dimensions := make(map[string]string)
+	for _, key := range env.EC2TagDimensions {
+		if value := e.tags[key]; value != "" {
+			dimensions[key] = value
+		}
+	}
+	if len(dimensions) > 0 {
+		if err := ctx.PutDefaultDimensions(dimensions); err != nil {
+			log.Println("Failed to add instance tags as dimensions:", err)
+		}
 	}
 }
 
 // GetSink returns the sink for the EC2 environment.
 func (e *EC2Environment) GetSink() sinks.Sink {
-	env := config.GetConfig()
-	if e.sink == nil {
-		e.sink = sinks.NewAgentSink(e.GetLogGroupName(), env.LogStreamName)
+	return e.getSink(func() sinks.Sink {
+		env := config.GetConfig()
+		return sinks.NewAgentSink(e.GetLogGroupName(), env.LogStreamName)
+	})
+}
+
+func (e *EC2Environment) addProperty(ctx *context.MetricsContext, key, value string) {
+	if value != "" {
+		ctx.SetProperty(key, value)
 	}
-	return e.sink
 }
@@ -0,0 +1,130 @@
+package environments
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/context"
+)
+
+func newTaggedIMDS(t *testing.T) {
+	server := newFakeIMDS(t, &fakeIMDS{paths: map[string]string{
+		lifeCyclePath:                           "spot",
+		tagsPath:                                "Team\nStage\nCluster\naws:autoscaling:groupName\n",
+		tagsPath + "/Team":                      "payments",
+		tagsPath + "/Stage":                     "prod",
+		tagsPath + "/Cluster":                   "blue",
+		tagsPath + "/aws:autoscaling:groupName": "payments-asg",
+	}})
+	t.Setenv("AWS_EMF_EC2_METADATA_ENDPOINT", server.URL)
+	t.Setenv("AWS_EMF_EC2_INSTANCE_TAGS", "")
+	t.Setenv("AWS_EMF_EC2_TAG_DIMENSIONS", "")
+}
+
+func TestEC2EnvironmentConfigureContextWithExtendedMetadata(t *testing.T) {
+
+	newTaggedIMDS(t)
+	env := &EC2Environment{}
+	if !env.Probe() {
+		t.Fatalf("Expected probe to succeed")
+	}
+
+	ctx := context.Empty()
+	env.ConfigureContext(&ctx)
+
+	expected := map[string]any{
+		"imageId":           "ami-1",
+		"instanceId":        "i-1",
+		"instanceType":      "t3.micro",
+		"privateIP":         "10.0.0.1",
+		"availabilityZone":  "us-west-2b",
+		"region":            "us-west-2",
+		"accountId":         "123456789012",
+		"instanceLifeCycle": "spot",
+	}
+	if !reflect.DeepEqual(ctx.Properties, expected) {
+		t.Errorf("Expected %v, got %v", expected, ctx.Properties)
+	}
+	if env.tags != nil {
+		t.Errorf("Expected tags not to be fetched unless configured, got %v", env.tags)
+	}
+}
+
+func TestEC2EnvironmentConfigureContextWithTags(t *testing.T) {
+
+	newTaggedIMDS(t)
+	t.Setenv("AWS_EMF_EC2_INSTANCE_TAGS", "true")
+	t.Setenv("AWS_EMF_EC2_TAG_DIMENSIONS", "Team,Stage,Missing")
+	env := &EC2Environment{}
+	if !env.Probe() {
+		t.Fatalf("Expected probe to succeed")
+	}
+
+	ctx := context.Empty()
+	ctx.SetDefaultDimensions(map[string]string{"ServiceName": "svc"})
+	env.ConfigureContext(&ctx)
+
+	expectedTags := map[string]string{"Team": "payments", "Stage": "prod", "Cluster": "blue", "aws:autoscaling:groupName": "payments-asg"}
+	if !reflect.DeepEqual(ctx.Properties["tags"], expectedTags) {
+		t.Errorf("Expected %v, got %v", expectedTags, ctx.Properties["tags"])
+	}
+	if ctx.Properties["autoScalingGroup"] != "payments-asg" {
+		t.Errorf("Expected %v, got %v", "payments-asg", ctx.Properties["autoScalingGroup"])
+	}
+
+	expectedDimensions := []map[string]string{{"ServiceName": "svc", "Team": "payments", "Stage": "prod"}}
+	if dimensions := ctx.GetDimensions(); !reflect.DeepEqual(dimensions, expectedDimensions) {
+		t.Errorf("Expected %v, got %v", expectedDimensions, dimensions)
+	}
+}
+
+func TestEC2EnvironmentTagDimensionsWithoutTagAccess(t *testing.T) {
+
+	server := newFakeIMDS(t, &fakeIMDS{})
+	t.Setenv("AWS_EMF_EC2_METADATA_ENDPOINT", server.URL)
+	t.Setenv("AWS_EMF_EC2_TAG_DIMENSIONS", "Team")
+	env := &EC2Environment{}
+	if !env.Probe() {
+		t.Fatalf("Expected probe to succeed without access to tags")
+	}
+
+	ctx := context.Empty()
+	env.ConfigureContext(&ctx)
+	if dimensions := ctx.GetDimensions(); len(dimensions) != 0 {
+		t.Errorf("Expected no dimensions, got %v", dimensions)
+	}
+}
+
+func TestEC2EnvironmentProbeUsesCurrentConfig(t *testing.T) {
+
+	newTaggedIMDS(t)
+	t.Setenv("AWS_EMF_EC2_INSTANCE_TAGS", "true")
+	env := &EC2Environment{}
+	if !env.Probe() {
+		t.Fatalf("Expected probe to succeed")
+	}
+
+	imds := &fakeIMDS{}
+	server := newFakeIMDS(t, imds)
+	t.Setenv("AWS_EMF_EC2_METADATA_ENDPOINT", server.URL)
+	if !env.Probe() {
+		t.Fatalf("Expected probe to succeed")
+	}
+	imds.mutex.Lock()
+	tokenRequests := imds.tokenRequests
+	imds.mutex.Unlock()
+	if tokenRequests != 1 {
+		t.Errorf("Expected the probe to use the current endpoint, got %d token requests", tokenRequests)
+	}
+	if env.lifeCycle != "" || len(env.tags) != 0 {
+		t.Errorf("Expected no metadata of the previous probe, got %q and %v", env.lifeCycle, env.tags)
+	}
+
+	server.Close()
+	if env.Probe() {
+		t.Fatalf("Expected probe to fail")
+	}
+	if env.metadata != nil {
+		t.Errorf("Expected no metadata after a failed probe, got %v", env.metadata)
+	}
+}
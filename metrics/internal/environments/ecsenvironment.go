@@ -10,6 +10,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/config"
 	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/context"
@@ -23,7 +24,7 @@ type ECSMetadataResponse struct {
 	Image              string               `json:"Image"`
 	FormattedImageName string               `json:"FormattedImageName"`
 	ImageID            string               `json:"ImageID"`
-	Ports              string               `json:"Ports"`
+	Ports              []ECSMetadataPort    `json:"Ports"`
 	Labels             ECSMetadataLabels    `json:"Labels"`
 	CreatedAt          string               `json:"CreatedAt"`
 	StartedAt          string               `json:"StartedAt"`
@@ -38,18 +39,38 @@ type ECSMetadataLabels struct {
 	TaskDefinitionVersion string `json:"com.amazonaws.ecs.task-definition-version"`
 }
 
+type ECSMetadataPort struct {
+	ContainerPort int    `json:"ContainerPort"`
+	Protocol      string `json:"Protocol"`
+	HostPort      int    `json:"HostPort"`
+}
+
+// ECSTaskMetadataResponse is the response of the /task path of the task metadata endpoint.
+// LaunchType and AvailabilityZone are only returned by version 4 of the endpoint.
+type ECSTaskMetadataResponse struct {
+	Cluster          string `json:"Cluster"`
+	TaskARN          string `json:"TaskARN"`
+	Family           string `json:"Family"`
+	Revision         string `json:"Revision"`
+	AvailabilityZone string `json:"AvailabilityZone"`
+	LaunchType       string `json:"LaunchType"`
+}
+
 type ECSMetadataNetwork struct {
 	NetworkMode   string   `json:"NetworkMode"`
 	IPv4Addresses []string `json:"IPv4Addresses"`
 }
 
 type ECSEnvironment struct {
-	sink              sinks.Sink
-	metadata          *ECSMetadataResponse
-	fluentBitEndpoint string
-	mutex             sync.Mutex
+	sinkCache
+	metadata     *ECSMetadataResponse
+	taskMetadata *ECSTaskMetadataResponse
+	probeErr     error
+	mutex        sync.Mutex
 }
 
+var ecsMetadataClient = &http.Client{Timeout: 2 * time.Second}
+
 func formatImageName(imageName string) string {
 	if imageName == "" {
 		return imageName
@@ -70,43 +91,63 @@ func (e *ECSEnvironment) Probe() bool {
 	e.mutex.Lock()
 	defer e.mutex.Unlock()
 
-	ecsMetadataURI := os.Getenv("ECS_CONTAINER_METADATA_URI")
+	e.probeErr = nil
+	ecsMetadataURI := os.Getenv("ECS_CONTAINER_METADATA_URI_V4")
 	if ecsMetadataURI == "" {
-		return false
+		ecsMetadataURI = os.Getenv("ECS_CONTAINER_METADATA_URI")
 	}
-
-	fluentHost := os.Getenv("FLUENT_HOST")
-	env := config.GetConfig()
-	if fluentHost != "" && env.AgentEndpoint == "" {
-		e.fluentBitEndpoint = fmt.Sprintf("tcp://%s:%d", fluentHost, 25888)
-		env.AgentEndpoint = e.fluentBitEndpoint
-		fmt.Printf("Using FluentBit configuration. Endpoint: %s\n", e.fluentBitEndpoint)
+	if ecsMetadataURI == "" {
+		e.probeErr = errors.New("ECS_CONTAINER_METADATA_URI_V4 and ECS_CONTAINER_METADATA_URI are not set")
+		return false
 	}
 
 	u, err := url.Parse(ecsMetadataURI)
 	if err != nil {
-		log.Println("Failed to parse ECS_CONTAINER_METADATA_URI:", err)
+		log.Println("Failed to parse ECS container metadata URI:", err)
+		e.probeErr = err
 		return false
 	}
 
-	resp, err := http.Get(u.String())
-	if err != nil || resp.StatusCode != http.StatusOK {
+	metadata := &ECSMetadataResponse{}
+	if err := fetchECSMetadata(u.String(), metadata); err != nil {
 		log.Println("Failed to collect ECS Container Metadata:", err)
+		e.probeErr = err
 		return false
 	}
-	defer resp.Body.Close()
+	metadata.FormattedImageName = formatImageName(metadata.Image)
+	e.metadata = metadata
+	log.Println("Successfully collected ECS Container metadata.")
 
-	if err := json.NewDecoder(resp.Body).Decode(e.metadata); err != nil {
-		log.Println("Error decoding ECS metadata:", err)
-		return false
+	// the task metadata only enriches the context, the container metadata is enough to
+	// detect ECS
+	taskMetadata := &ECSTaskMetadataResponse{}
+	if err := fetchECSMetadata(u.JoinPath("task").String(), taskMetadata); err != nil {
+		log.Println("Failed to collect ECS Task Metadata:", err)
+	} else {
+		e.taskMetadata = taskMetadata
 	}
 
-	if e.metadata != nil {
-		e.metadata.FormattedImageName = formatImageName(e.metadata.Image)
-		log.Println("Successfully collected ECS Container metadata.")
+	return true
+}
+
+func fetchECSMetadata(uri string, metadata any) error {
+	resp, err := ecsMetadataClient.Get(uri)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
 	}
+	return json.NewDecoder(resp.Body).Decode(metadata)
+}
 
-	return true
+// ProbeError tells why the last probe failed.
+func (e *ECSEnvironment) ProbeError() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.probeErr
 }
 
 func (e *ECSEnvironment) GetName() string {
@@ -121,50 +162,45 @@ func (e *ECSEnvironment) GetName() string {
 	return "Unknown"
 }
 
+// GetType returns AWS::ECS::Fargate for tasks on Fargate and AWS::ECS::Container for tasks
+// on EC2 or with an unknown launch type.
 func (e *ECSEnvironment) GetType() string {
+	if e.taskMetadata != nil && e.taskMetadata.LaunchType == "FARGATE" {
+		return "AWS::ECS::Fargate"
+	}
 	return "AWS::ECS::Container"
 }
 
 func (e *ECSEnvironment) GetLogGroupName() string {
-	env := config.GetConfig()
-	if e.fluentBitEndpoint != "" {
-		return ""
-	}
-
-	if env.LogGroupName != "" {
-		return env.LogGroupName
-	}
-
-	return e.GetName()
+	return agentLogGroupName(e.GetName())
 }
 
 func (e *ECSEnvironment) ConfigureContext(ctx *context.MetricsContext) {
-	env := config.GetConfig()
-	hostname, err := os.Hostname()
-	if err != nil {
-		panic(err)
+	if hostname, err := os.Hostname(); err == nil {
+		e.addProperty(ctx, "containerId", hostname)
 	}
-	e.addProperty(ctx, "containerId", hostname)
-	e.addProperty(ctx, "createdAt", e.metadata.CreatedAt)
-	e.addProperty(ctx, "startedAt", e.metadata.StartedAt)
-	e.addProperty(ctx, "image", e.metadata.Image)
-	e.addProperty(ctx, "cluster", e.metadata.Labels.Cluster)
-	e.addProperty(ctx, "taskArn", e.metadata.Labels.TaskArn)
-
-	if e.fluentBitEndpoint != "" {
-		ctx.SetDefaultDimensions(map[string]string{
-			"ServiceName": env.ServiceName,
-			"ServiceType": e.GetType(),
-		})
+	if e.metadata != nil {
+		e.addProperty(ctx, "createdAt", e.metadata.CreatedAt)
+		e.addProperty(ctx, "startedAt", e.metadata.StartedAt)
+		e.addProperty(ctx, "image", e.metadata.Image)
+		e.addProperty(ctx, "cluster", e.metadata.Labels.Cluster)
+		e.addProperty(ctx, "taskArn", e.metadata.Labels.TaskArn)
+	}
+	if e.taskMetadata != nil {
+		e.addProperty(ctx, "cluster", e.taskMetadata.Cluster)
+		e.addProperty(ctx, "taskArn", e.taskMetadata.TaskARN)
+		e.addProperty(ctx, "taskDefinitionFamily", e.taskMetadata.Family)
+		e.addProperty(ctx, "taskDefinitionRevision", e.taskMetadata.Revision)
+		e.addProperty(ctx, "availabilityZone", e.taskMetadata.AvailabilityZone)
+		e.addProperty(ctx, "launchType", e.taskMetadata.LaunchType)
 	}
 }
 
 func (e *ECSEnvironment) GetSink() sinks.Sink {
-	env := config.GetConfig()
-	if e.sink == nil {
-		e.sink = sinks.NewAgentSink(e.GetLogGroupName(), env.LogStreamName)
-	}
-	return e.sink
+	return e.getSink(func() sinks.Sink {
+		env := config.GetConfig()
+		return sinks.NewAgentSink(e.GetLogGroupName(), env.LogStreamName)
+	})
 }
 
 func (e *ECSEnvironment) addProperty(ctx *context.MetricsContext, key, value string) {
@@ -1,7 +1,229 @@
 package environments
 
-import "testing"
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
 
-func TestECSNeedsHelp(t *testing.T) {
-	t.Skip("Not yet implemented")
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/context"
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/sinks"
+)
+
+const ecsContainerMetadata = `{
+	"DockerId": "ea32192c8553fbff06c9340478a2ff089b2bb5646fb718b4ee206641c9086d66",
+	"Name": "curl",
+	"DockerName": "ecs-curltest-24-curl-cca48e8dcadd97805600",
+	"Image": "111122223333.dkr.ecr.us-west-2.amazonaws.com/curltest:latest",
+	"ImageID": "sha256:d691691e9652791a60114e67b365688d20d19940dde7c4736ea30e660d8d3553",
+	"Labels": {
+		"com.amazonaws.ecs.cluster": "default",
+		"com.amazonaws.ecs.container-name": "curl",
+		"com.amazonaws.ecs.task-arn": "arn:aws:ecs:us-west-2:111122223333:task/default/8f03e41243824aea923aca126495f665",
+		"com.amazonaws.ecs.task-definition-family": "curltest",
+		"com.amazonaws.ecs.task-definition-version": "24"
+	},
+	"CreatedAt": "2020-10-02T00:15:07.620912337Z",
+	"StartedAt": "2020-10-02T00:15:08.062559351Z",
+	"Ports": [{"ContainerPort": 80, "Protocol": "tcp", "HostPort": 80}],
+	"Networks": [{"NetworkMode": "awsvpc", "IPv4Addresses": ["10.0.2.106"]}]
+}`
+
+const ecsTaskMetadata = `{
+	"Cluster": "arn:aws:ecs:us-west-2:111122223333:cluster/default",
+	"TaskARN": "arn:aws:ecs:us-west-2:111122223333:task/default/158d1c8083dd49d6b527399fd6414f5c",
+	"Family": "curltest",
+	"Revision": "26",
+	"DesiredStatus": "RUNNING",
+	"KnownStatus": "RUNNING",
+	"AvailabilityZone": "us-west-2d",
+	"LaunchType": "%s"
+}`
+
+// newECSMetadataServer serves the container metadata and, unless taskMetadata is empty,
+// the task metadata.
+func newECSMetadataServer(t *testing.T, taskMetadata string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v4/container", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(ecsContainerMetadata))
+	})
+	if taskMetadata != "" {
+		mux.HandleFunc("/v4/container/task", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(taskMetadata))
+		})
+	}
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func setECSMetadataURIs(t *testing.T, v3, v4 string) {
+	t.Setenv("ECS_CONTAINER_METADATA_URI", v3)
+	t.Setenv("ECS_CONTAINER_METADATA_URI_V4", v4)
+	t.Setenv("FLUENT_HOST", "")
+	t.Setenv("AWS_EMF_AGENT_ENDPOINT", "")
+	t.Setenv("SERVICE_NAME", "")
+	t.Setenv("AWS_EMF_SERVICE_NAME", "")
+}
+
+func TestECSEnvironmentProbe(t *testing.T) {
+
+	server := newECSMetadataServer(t, "")
+
+	tests := []struct {
+		name     string
+		v3       string
+		v4       string
+		expected bool
+	}{
+		{name: "V4", v4: server.URL + "/v4/container", expected: true},
+		{name: "V3", v3: server.URL + "/v4/container", expected: true},
+		{name: "V4TakesPrecedence", v3: server.URL + "/missing", v4: server.URL + "/v4/container", expected: true},
+		{name: "NotFound", v4: server.URL + "/missing", expected: false},
+		{name: "NotECS", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setECSMetadataURIs(t, tt.v3, tt.v4)
+			env := &ECSEnvironment{}
+
+			if result := env.Probe(); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestECSEnvironmentConfigureContext(t *testing.T) {
+
+	server := newECSMetadataServer(t, fmt.Sprintf(ecsTaskMetadata, "FARGATE"))
+	setECSMetadataURIs(t, "", server.URL+"/v4/container")
+	env := &ECSEnvironment{}
+	if !env.Probe() {
+		t.Fatalf("Expected probe to succeed")
+	}
+
+	ctx := context.Empty()
+	env.ConfigureContext(&ctx)
+
+	expected := map[string]string{
+		"createdAt":              "2020-10-02T00:15:07.620912337Z",
+		"startedAt":              "2020-10-02T00:15:08.062559351Z",
+		"image":                  "111122223333.dkr.ecr.us-west-2.amazonaws.com/curltest:latest",
+		"cluster":                "arn:aws:ecs:us-west-2:111122223333:cluster/default",
+		"taskArn":                "arn:aws:ecs:us-west-2:111122223333:task/default/158d1c8083dd49d6b527399fd6414f5c",
+		"taskDefinitionFamily":   "curltest",
+		"taskDefinitionRevision": "26",
+		"availabilityZone":       "us-west-2d",
+		"launchType":             "FARGATE",
+	}
+	for key, value := range expected {
+		if ctx.Properties[key] != value {
+			t.Errorf("Expected %s to be %v, got %v", key, value, ctx.Properties[key])
+		}
+	}
+	if _, ok := ctx.Properties["containerId"]; !ok {
+		t.Errorf("Expected containerId to be set")
+	}
+	if env.GetName() != "curltest:latest" {
+		t.Errorf("Expected %v, got %v", "curltest:latest", env.GetName())
+	}
+}
+
+func TestECSEnvironmentWithoutTaskMetadata(t *testing.T) {
+
+	server := newECSMetadataServer(t, "")
+	setECSMetadataURIs(t, server.URL+"/v4/container", "")
+	env := &ECSEnvironment{}
+	if !env.Probe() {
+		t.Fatalf("Expected probe to succeed")
+	}
+
+	ctx := context.Empty()
+	env.ConfigureContext(&ctx)
+
+	expected := map[string]string{
+		"cluster": "default",
+		"taskArn": "arn:aws:ecs:us-west-2:111122223333:task/default/8f03e41243824aea923aca126495f665",
+	}
+	for key, value := range expected {
+		if ctx.Properties[key] != value {
+			t.Errorf("Expected %s to be %v, got %v", key, value, ctx.Properties[key])
+		}
+	}
+	if _, ok := ctx.Properties["launchType"]; ok {
+		t.Errorf("Expected no launchType without task metadata")
+	}
+}
+
+func TestECSEnvironmentConfigureContextWithoutMetadata(t *testing.T) {
+
+	env := &ECSEnvironment{}
+	ctx := context.Empty()
+	env.ConfigureContext(&ctx)
+
+	if _, ok := ctx.Properties["containerId"]; !ok {
+		t.Errorf("Expected containerId to be set")
+	}
+}
+
+func TestECSEnvironmentGetType(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		taskMetadata *ECSTaskMetadataResponse
+		expected     string
+	}{
+		{name: "Fargate", taskMetadata: &ECSTaskMetadataResponse{LaunchType: "FARGATE"}, expected: "AWS::ECS::Fargate"},
+		{name: "EC2", taskMetadata: &ECSTaskMetadataResponse{LaunchType: "EC2"}, expected: "AWS::ECS::Container"},
+		{name: "Unknown", taskMetadata: nil, expected: "AWS::ECS::Container"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := &ECSEnvironment{taskMetadata: tt.taskMetadata}
+			if result := env.GetType(); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestECSMetadataPorts(t *testing.T) {
+
+	server := newECSMetadataServer(t, "")
+	setECSMetadataURIs(t, "", server.URL+"/v4/container")
+	env := &ECSEnvironment{}
+	env.Probe()
+
+	expected := []ECSMetadataPort{{ContainerPort: 80, Protocol: "tcp", HostPort: 80}}
+	if !reflect.DeepEqual(env.metadata.Ports, expected) {
+		t.Errorf("Expected %v, got %v", expected, env.metadata.Ports)
+	}
+}
+
+func TestECSEnvironmentWithFluentBit(t *testing.T) {
+
+	server := newECSMetadataServer(t, "")
+	setECSMetadataURIs(t, "", server.URL+"/v4/container")
+	t.Setenv("FLUENT_HOST", "127.0.0.1")
+	t.Setenv("AWS_EMF_LOG_GROUP_NAME", "ignored")
+	env := &ECSEnvironment{}
+	if !env.Probe() {
+		t.Fatalf("Expected probe to succeed")
+	}
+
+	if env.GetLogGroupName() != "" {
+		t.Errorf("Expected no log group, got %v", env.GetLogGroupName())
+	}
+	sink, ok := env.GetSink().(*sinks.AgentSink)
+	if !ok {
+		t.Fatalf("Expected an agent sink, got %T", env.GetSink())
+	}
+	expected := sinks.Endpoint{Host: "127.0.0.1", Port: "25888", Protocol: "tcp"}
+	if sink.Endpoint != expected {
+		t.Errorf("Expected %v, got %v", expected, sink.Endpoint)
+	}
 }
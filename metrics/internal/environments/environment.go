@@ -1,6 +1,9 @@
 package environments
 
 import (
+	"sync"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/config"
 	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/context"
 	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/sinks"
 )
@@ -12,4 +15,49 @@ type Environment interface {
 	GetLogGroupName() string
 	ConfigureContext(context *context.MetricsContext)
 	GetSink() sinks.Sink
+	// CloseSink closes the sink returned by GetSink, the next call creates a new one.
+	CloseSink() error
+}
+
+// agentLogGroupName returns the log group of an environment that sends its events to the
+// agent: LOG_GROUP_NAME if configured, else defaultName. In the Fluent Bit mode the log
+// group is chosen by the Fluent Bit output, so none is returned.
+func agentLogGroupName(defaultName string) string {
+	env := config.GetConfig()
+	if env.FluentBitEnabled() {
+		return ""
+	}
+	if env.LogGroupName != "" {
+		return env.LogGroupName
+	}
+	return defaultName
+}
+
+// sinkCache holds the sink of an environment until it is closed.
+type sinkCache struct {
+	sinkMutex sync.Mutex
+	sink      sinks.Sink
+}
+
+// getSink returns the cached sink, creating it with newSink if there is none.
+func (c *sinkCache) getSink(newSink func() sinks.Sink) sinks.Sink {
+	c.sinkMutex.Lock()
+	defer c.sinkMutex.Unlock()
+
+	if c.sink == nil {
+		c.sink = newSink()
+	}
+	return c.sink
+}
+
+func (c *sinkCache) CloseSink() error {
+	c.sinkMutex.Lock()
+	defer c.sinkMutex.Unlock()
+
+	if c.sink == nil {
+		return nil
+	}
+	err := c.sink.Close()
+	c.sink = nil
+	return err
 }
@@ -2,30 +2,171 @@ package environments
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/config"
 	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/utils"
 )
 
 var (
-	lambdaEnvironment  = &LambdaEnvironment{}
-	ecsEnvironment     = &ECSEnvironment{}
-	ec2Environment     = &EC2Environment{}
-	defaultEnvironment = &DefaultEnvironment{}
-	localEnvironment   = &LocalEnvironment{}
+	lambdaEnvironment     = &LambdaEnvironment{}
+	ecsEnvironment        = &ECSEnvironment{}
+	kubernetesEnvironment = &KubernetesEnvironment{}
+	appRunnerEnvironment  = &AppRunnerEnvironment{}
+	beanstalkEnvironment  = &BeanstalkEnvironment{}
+	ec2Environment        = &EC2Environment{}
+	defaultEnvironment    = &DefaultEnvironment{}
+	localEnvironment      = &LocalEnvironment{}
 )
 
-var environments = []Environment{
-	lambdaEnvironment,
-	ecsEnvironment,
-	ec2Environment,
+// Probe priorities of the built-in environments, environments with a higher priority are
+// probed first. EKS nodes and Elastic Beanstalk instances are EC2 instances, so they have
+// to be probed before EC2.
+const (
+	LambdaPriority           = 60
+	AppRunnerPriority        = 50
+	ECSPriority              = 40
+	EKSPriority              = 30
+	ElasticBeanstalkPriority = 20
+	EC2Priority              = 10
+)
+
+type probe struct {
+	name        string
+	environment Environment
+	priority    int
+}
+
+var probesMutex sync.Mutex
+
+var probes = []probe{
+	{string(utils.Lambda), lambdaEnvironment, LambdaPriority},
+	{string(utils.AppRunner), appRunnerEnvironment, AppRunnerPriority},
+	{string(utils.ECS), ecsEnvironment, ECSPriority},
+	{string(utils.EKS), kubernetesEnvironment, EKSPriority},
+	{string(utils.ElasticBeanstalk), beanstalkEnvironment, ElasticBeanstalkPriority},
+	{string(utils.EC2), ec2Environment, EC2Priority},
+}
+
+// ProbeResult is the outcome of a single probe during environment discovery.
+type ProbeResult struct {
+	Name     string
+	Priority int
+	// Matched is set for the probe that won.
+	Matched bool
+	// Reason tells why the probe did not match, e.g. because it was disabled, failed or
+	// was not run since a probe before it matched.
+	Reason string
+	// Duration is how long the probe ran, or ran until the discovery stopped waiting for it.
+	Duration time.Duration
+}
+
+// Detection describes how the environment was resolved.
+type Detection struct {
+	// Override is the configured environment override, if it was applied.
+	Override string
+	// Winner is the name of the probe that matched, empty if the environment was
+	// overridden or no probe matched.
+	Winner string
+	Probes []ProbeResult
+	// Duration is how long the discovery took.
+	Duration time.Duration
+}
+
+func (d Detection) String() string {
+	if d.Override != "" {
+		return "environment override: " + d.Override
+	}
+	var b strings.Builder
+	if d.Winner != "" {
+		b.WriteString("detected " + d.Winner)
+	} else {
+		b.WriteString("no probe matched, using the default environment")
+	}
+	for _, result := range d.Probes {
+		if !result.Matched {
+			fmt.Fprintf(&b, "; %s: %s", result.Name, result.Reason)
+		}
+	}
+	return b.String()
+}
+
+// probeErrorer is implemented by environments that can tell why their last probe failed.
+type probeErrorer interface {
+	ProbeError() error
+}
+
+var (
+	detection      Detection
+	detectionMutex sync.Mutex
+)
+
+// defaultDiscoveryTimeout bounds the environment discovery if DISCOVERY_TIMEOUT is not
+// configured.
+const defaultDiscoveryTimeout = 3 * time.Second
+
+// RegisterEnvironment adds an environment to the discovery. Environments are probed by
+// descending priority; an environment registered with the same priority as another one is
+// probed after it. Registering an environment with the name of a registered one replaces it.
+func RegisterEnvironment(name string, env Environment, priority int) {
+	probesMutex.Lock()
+	defer probesMutex.Unlock()
+
+	for i, p := range probes {
+		if strings.EqualFold(p.name, name) {
+			probes = append(probes[:i:i], probes[i+1:]...)
+			break
+		}
+	}
+	probes = append(probes, probe{name, env, priority})
+}
+
+// orderedProbes returns the probes in the order they are run: the probes named in the
+// PROBE_ORDER config first, in that order, followed by the others by descending priority.
+func orderedProbes(order []string) []probe {
+	probesMutex.Lock()
+	ordered := append([]probe(nil), probes...)
+	probesMutex.Unlock()
+
+	rank := func(p probe) int {
+		for i, name := range order {
+			if strings.EqualFold(p.name, name) {
+				return i
+			}
+		}
+		return len(order)
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		ri, rj := rank(ordered[i]), rank(ordered[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return ordered[i].priority > ordered[j].priority
+	})
+	return ordered
+}
+
+func isDisabled(name string, disabled []string) bool {
+	for _, d := range disabled {
+		if strings.EqualFold(name, d) {
+			return true
+		}
+	}
+	return false
 }
 
 var environment Environment
 var once sync.Once
 
+// resolveMutex guards environment and once, which CleanResolveEnvironment resets while
+// another goroutine, e.g. one started by Init, may be resolving.
+var resolveMutex sync.Mutex
+
 func getEnvironmentFromOverride() (Environment, error) {
 	env := config.GetConfig()
 	switch env.EnvironmentOverride {
@@ -37,6 +178,12 @@ func getEnvironmentFromOverride() (Environment, error) {
 		return lambdaEnvironment, nil
 	case utils.ECS:
 		return NewECSEnvironment()
+	case utils.EKS:
+		return NewKubernetesEnvironment()
+	case utils.AppRunner:
+		return appRunnerEnvironment, nil
+	case utils.ElasticBeanstalk:
+		return NewBeanstalkEnvironment()
 	case utils.Local:
 		return localEnvironment, nil
 	default:
@@ -44,21 +191,136 @@ func getEnvironmentFromOverride() (Environment, error) {
 	}
 }
 
+// probeOutcome is sent by a probe running concurrently with the others.
+type probeOutcome struct {
+	index    int
+	matched  bool
+	reason   string
+	duration time.Duration
+}
+
+// discoverEnvironment runs all enabled probes concurrently. The first probe in probe order
+// that matches wins as soon as all probes before it failed. Probes still running when the
+// discovery timeout expires are abandoned, and the first of the finished probes that
+// matched wins.
 func discoverEnvironment() (Environment, error) {
 	log.Println("Discovering environment")
-	for _, env := range environments {
-		log.Printf("Testing: %T", env)
+	env := config.GetConfig()
+	timeout := env.DiscoveryTimeout
+	if timeout <= 0 {
+		timeout = defaultDiscoveryTimeout
+	}
 
-		if err := env.Probe(); err {
-			return env, nil
-		} else {
-			log.Printf("Failed probe: %T", env)
+	start := time.Now()
+	ordered := orderedProbes(env.ProbeOrder)
+	results := make([]ProbeResult, len(ordered))
+	finished := make([]bool, len(ordered))
+	// buffered, so abandoned probes do not block when they finish
+	outcomes := make(chan probeOutcome, len(ordered))
+	running := 0
+	for i, p := range ordered {
+		results[i] = ProbeResult{Name: p.name, Priority: p.priority}
+		if isDisabled(p.name, env.DisabledProbes) {
+			results[i].Reason = "disabled by configuration"
+			finished[i] = true
+			continue
 		}
+		running++
+		go runProbe(i, p, outcomes)
 	}
-	return defaultEnvironment, nil
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	winner := -1
+	for running > 0 && winner < 0 {
+		select {
+		case outcome := <-outcomes:
+			running--
+			finished[outcome.index] = true
+			results[outcome.index].Matched = outcome.matched
+			results[outcome.index].Reason = outcome.reason
+			results[outcome.index].Duration = outcome.duration
+			winner = decidedWinner(results, finished)
+		case <-timer.C:
+			log.Printf("Environment discovery timed out after %v", timeout)
+			for i := range results {
+				if !finished[i] {
+					results[i].Reason = "timed out"
+					results[i].Duration = time.Since(start)
+					finished[i] = true
+				}
+			}
+			winner = decidedWinner(results, finished)
+			running = 0
+		}
+	}
+
+	d := Detection{Probes: results, Duration: time.Since(start)}
+	if winner >= 0 {
+		d.Winner = ordered[winner].name
+		for i := range results {
+			if i == winner {
+				continue
+			}
+			if !finished[i] {
+				results[i].Reason = "not awaited, " + d.Winner + " matched first"
+				results[i].Duration = d.Duration
+			} else if results[i].Matched {
+				results[i].Matched = false
+				results[i].Reason = "matched, but " + d.Winner + " comes first"
+			}
+		}
+	}
+	setDetection(d)
+	log.Printf("Environment discovery: %s", d)
+
+	if winner < 0 {
+		return defaultEnvironment, nil
+	}
+	return ordered[winner].environment, nil
+}
+
+func runProbe(index int, p probe, outcomes chan<- probeOutcome) {
+	outcome := probeOutcome{index: index}
+	start := time.Now()
+	defer func() {
+		outcome.duration = time.Since(start)
+		if r := recover(); r != nil {
+			outcome.matched = false
+			outcome.reason = fmt.Sprintf("probe panicked: %v", r)
+		}
+		outcomes <- outcome
+	}()
+
+	log.Printf("Testing: %s", p.name)
+	if outcome.matched = p.environment.Probe(); outcome.matched {
+		return
+	}
+	outcome.reason = "probe failed"
+	if e, ok := p.environment.(probeErrorer); ok && e.ProbeError() != nil {
+		outcome.reason += ": " + e.ProbeError().Error()
+	}
+	log.Printf("Failed probe: %s", p.name)
+}
+
+// decidedWinner returns the first probe that matched if all probes before it are finished,
+// or -1.
+func decidedWinner(results []ProbeResult, finished []bool) int {
+	for i := range results {
+		if !finished[i] {
+			return -1
+		}
+		if results[i].Matched {
+			return i
+		}
+	}
+	return -1
 }
 
 func ResolveEnvironment() (Environment, error) {
+	resolveMutex.Lock()
+	defer resolveMutex.Unlock()
+
 	once.Do(func() {
 		var err error
 		log.Println("Resolving environment")
@@ -67,6 +329,7 @@ func ResolveEnvironment() (Environment, error) {
 			log.Printf("Environment override supplied: %s", env.EnvironmentOverride)
 			environment, err = getEnvironmentFromOverride()
 			if err == nil {
+				setDetection(Detection{Override: string(env.EnvironmentOverride)})
 				return
 			}
 			log.Printf("Invalid environment provided. Falling back to auto-discovery: %s", env.EnvironmentOverride)
@@ -83,7 +346,62 @@ func ResolveEnvironment() (Environment, error) {
 	return environment, nil
 }
 
+// LastDetection returns how the environment was last resolved.
+func LastDetection() Detection {
+	detectionMutex.Lock()
+	defer detectionMutex.Unlock()
+	return detection
+}
+
+func setDetection(d Detection) {
+	detectionMutex.Lock()
+	defer detectionMutex.Unlock()
+	detection = d
+}
+
+// CleanResolveEnvironment resets the environments and resolves the environment again.
 func CleanResolveEnvironment() (Environment, error) {
-	once = sync.Once{}
+	Reset()
 	return ResolveEnvironment()
 }
+
+// Close closes the sinks of all environments, the next flush opens new ones.
+func Close() error {
+	resolveMutex.Lock()
+	defer resolveMutex.Unlock()
+	return closeSinks()
+}
+
+// Reset closes the sinks of all environments and forgets the resolved environment, so the
+// next ResolveEnvironment detects it again with the current config.
+func Reset() error {
+	resolveMutex.Lock()
+	defer resolveMutex.Unlock()
+
+	err := closeSinks()
+	once = sync.Once{}
+	environment = nil
+	setDetection(Detection{})
+	return err
+}
+
+func closeSinks() error {
+	known := []Environment{defaultEnvironment, localEnvironment}
+	probesMutex.Lock()
+	for _, p := range probes {
+		known = append(known, p.environment)
+	}
+	probesMutex.Unlock()
+	// environments created for an override are not registered
+	if environment != nil {
+		known = append(known, environment)
+	}
+
+	var errs []error
+	for _, env := range known {
+		if err := env.CloseSink(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -1,7 +1,274 @@
 package environments
 
-import "testing"
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
 
-func TestDetectorNeedsHelp(t *testing.T) {
-	t.Skip("Not yet implemented")
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/context"
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/sinks"
+)
+
+type fakeEnvironment struct {
+	sinkCache
+	name    string
+	matches bool
+	err     error
+	// block, if set, delays the probe until it is closed.
+	block  chan struct{}
+	probed atomic.Bool
+}
+
+func (e *fakeEnvironment) Probe() bool {
+	e.probed.Store(true)
+	if e.block != nil {
+		<-e.block
+	}
+	return e.matches
+}
+
+func (e *fakeEnvironment) ProbeError() error {
+	return e.err
+}
+
+func (e *fakeEnvironment) GetName() string {
+	return e.name
+}
+
+func (e *fakeEnvironment) GetType() string {
+	return e.name
+}
+
+func (e *fakeEnvironment) GetLogGroupName() string {
+	return e.name
+}
+
+func (e *fakeEnvironment) ConfigureContext(ctx *context.MetricsContext) {}
+
+func (e *fakeEnvironment) GetSink() sinks.Sink {
+	return e.getSink(func() sinks.Sink {
+		return sinks.NewConsoleSink()
+	})
+}
+
+// useProbes replaces the registered probes for the duration of the test.
+func useProbes(t *testing.T, registered ...probe) {
+	original := probes
+	probes = registered
+	t.Setenv("AWS_EMF_PROBE_ORDER", "")
+	t.Setenv("AWS_EMF_DISABLED_PROBES", "")
+	t.Setenv("AWS_EMF_DISCOVERY_TIMEOUT", "")
+	t.Cleanup(func() {
+		probes = original
+	})
+}
+
+func TestDiscoverEnvironmentByPriority(t *testing.T) {
+
+	low := &fakeEnvironment{name: "Low", matches: true, block: make(chan struct{})}
+	defer close(low.block)
+	high := &fakeEnvironment{name: "High", err: errors.New("not here")}
+	middle := &fakeEnvironment{name: "Middle", matches: true}
+	useProbes(t, probe{"Low", low, 10}, probe{"High", high, 30}, probe{"Middle", middle, 20})
+
+	env, err := discoverEnvironment()
+	if err != nil || env != middle {
+		t.Fatalf("Expected %v, got %v, %v", middle, env, err)
+	}
+
+	expected := []ProbeResult{
+		{Name: "High", Priority: 30, Reason: "probe failed: not here"},
+		{Name: "Middle", Priority: 20, Matched: true},
+		{Name: "Low", Priority: 10, Reason: "not awaited, Middle matched first"},
+	}
+	detection := LastDetection()
+	if detection.Winner != "Middle" {
+		t.Errorf("Expected %v, got %v", "Middle", detection.Winner)
+	}
+	if len(detection.Probes) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, detection.Probes)
+	}
+	for i, result := range detection.Probes {
+		if result.Duration <= 0 {
+			t.Errorf("Expected the duration of %s to be recorded", result.Name)
+		}
+		result.Duration = 0
+		if result != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], result)
+		}
+	}
+}
+
+func TestDiscoverEnvironmentWithDisabledProbes(t *testing.T) {
+
+	first := &fakeEnvironment{name: "First", matches: true}
+	second := &fakeEnvironment{name: "Second", matches: true}
+	useProbes(t, probe{"First", first, 20}, probe{"Second", second, 10})
+	t.Setenv("AWS_EMF_DISABLED_PROBES", "first")
+
+	env, _ := discoverEnvironment()
+	if env != second {
+		t.Errorf("Expected %v, got %v", second, env)
+	}
+	if first.probed.Load() {
+		t.Errorf("Expected the disabled probe not to run")
+	}
+	if reason := LastDetection().Probes[0].Reason; reason != "disabled by configuration" {
+		t.Errorf("Expected %v, got %v", "disabled by configuration", reason)
+	}
+}
+
+func TestDiscoverEnvironmentWaitsForHigherPriority(t *testing.T) {
+
+	high := &fakeEnvironment{name: "High", matches: true, block: make(chan struct{})}
+	low := &fakeEnvironment{name: "Low", matches: true}
+	useProbes(t, probe{"High", high, 20}, probe{"Low", low, 10})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(high.block)
+	}()
+
+	env, _ := discoverEnvironment()
+	if env != high {
+		t.Errorf("Expected %v, got %v", high, env)
+	}
+	if reason := LastDetection().Probes[1].Reason; reason != "matched, but High comes first" {
+		t.Errorf("Expected %v, got %v", "matched, but High comes first", reason)
+	}
+}
+
+func TestDiscoverEnvironmentTimesOut(t *testing.T) {
+
+	slow := &fakeEnvironment{name: "Slow", matches: true, block: make(chan struct{})}
+	defer close(slow.block)
+	fast := &fakeEnvironment{name: "Fast", matches: true}
+	useProbes(t, probe{"Slow", slow, 20}, probe{"Fast", fast, 10})
+	t.Setenv("AWS_EMF_DISCOVERY_TIMEOUT", "50ms")
+
+	start := time.Now()
+	env, _ := discoverEnvironment()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected discovery to give up after the timeout, took %v", elapsed)
+	}
+	if env != fast {
+		t.Errorf("Expected %v, got %v", fast, env)
+	}
+	if reason := LastDetection().Probes[0].Reason; reason != "timed out" {
+		t.Errorf("Expected %v, got %v", "timed out", reason)
+	}
+}
+
+func TestDiscoverEnvironmentRecoversPanickingProbe(t *testing.T) {
+
+	useProbes(t, probe{"Panicking", panickingEnvironment{&fakeEnvironment{name: "Panicking"}}, 20}, probe{"Fallback", &fakeEnvironment{name: "Fallback", matches: true}, 10})
+
+	discoverEnvironment()
+	if detection := LastDetection(); detection.Winner != "Fallback" || detection.Probes[0].Reason != "probe panicked: boom" {
+		t.Errorf("Expected Fallback to win after the panic, got %v", detection)
+	}
+}
+
+type panickingEnvironment struct {
+	*fakeEnvironment
+}
+
+func (e panickingEnvironment) Probe() bool {
+	panic("boom")
+}
+
+func TestDiscoverEnvironmentFallsBackToDefault(t *testing.T) {
+
+	useProbes(t, probe{"First", &fakeEnvironment{name: "First"}, 10})
+
+	env, _ := discoverEnvironment()
+	if env != defaultEnvironment {
+		t.Errorf("Expected the default environment, got %v", env)
+	}
+	if detection := LastDetection(); detection.Winner != "" || !strings.HasPrefix(detection.String(), "no probe matched") {
+		t.Errorf("Expected no winner, got %v", detection)
+	}
+}
+
+func TestOrderedProbes(t *testing.T) {
+
+	useProbes(t, probe{"A", nil, 30}, probe{"B", nil, 20}, probe{"C", nil, 20}, probe{"D", nil, 10})
+
+	tests := []struct {
+		order    []string
+		expected string
+	}{
+		{nil, "ABCD"},
+		{[]string{"D", "b"}, "DBAC"},
+		{[]string{"Unknown", "C"}, "CABD"},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.order, ","), func(t *testing.T) {
+			var result string
+			for _, p := range orderedProbes(tt.order) {
+				result += p.name
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestRegisterEnvironment(t *testing.T) {
+
+	useProbes(t, probe{"Builtin", &fakeEnvironment{name: "Builtin"}, 10})
+	custom := &fakeEnvironment{name: "Custom", matches: true}
+	RegisterEnvironment("Custom", &fakeEnvironment{name: "Replaced"}, 10)
+	RegisterEnvironment("Custom", custom, 10)
+
+	ordered := orderedProbes(nil)
+	if len(ordered) != 2 || ordered[0].name != "Builtin" || ordered[1].environment != custom {
+		t.Errorf("Expected the custom environment after the builtin one, got %v", ordered)
+	}
+}
+
+func TestResolveEnvironmentRecordsOverride(t *testing.T) {
+
+	t.Setenv("AWS_EMF_ENVIRONMENT", "Local")
+	env, err := CleanResolveEnvironment()
+	if err != nil || env != localEnvironment {
+		t.Fatalf("Expected the local environment, got %v, %v", env, err)
+	}
+	if detection := LastDetection(); detection.Override != "Local" || len(detection.Probes) != 0 {
+		t.Errorf("Expected the Local override, got %v", detection)
+	}
+}
+
+func TestResetClosesSinksAndForgetsEnvironment(t *testing.T) {
+
+	fake := &fakeEnvironment{name: "Fake", matches: true}
+	useProbes(t, probe{"Fake", fake, 10})
+	t.Setenv("AWS_EMF_ENVIRONMENT", "")
+	t.Cleanup(func() {
+		Reset()
+	})
+
+	env, _ := CleanResolveEnvironment()
+	sink := env.GetSink()
+	if err := Reset(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if fake.sink != nil {
+		t.Errorf("Expected the cached sink to be dropped")
+	}
+	if LastDetection().Winner != "" {
+		t.Errorf("Expected the detection to be reset, got %v", LastDetection())
+	}
+
+	t.Setenv("AWS_EMF_ENVIRONMENT", "Local")
+	env, _ = ResolveEnvironment()
+	if env != localEnvironment {
+		t.Errorf("Expected the environment to be resolved again, got %v", env)
+	}
+	if fake.GetSink() == sink {
+		t.Errorf("Expected a new sink after the reset")
+	}
 }
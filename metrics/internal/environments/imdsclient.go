@@ -0,0 +1,177 @@
+package environments
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/config"
+)
+
+const (
+	defaultIMDSEndpoint           = "http://169.254.169.254"
+	defaultIMDSTimeout            = time.Second
+	defaultIMDSTokenTTL           = 6 * time.Hour
+	tokenPath                     = "/latest/api/token"
+	tokenRequestHeaderKey         = "X-aws-ec2-metadata-token-ttl-seconds"
+	metadataRequestTokenHeaderKey = "X-aws-ec2-metadata-token"
+	// tokenRefreshWindow is how long before its expiry a token is refreshed.
+	tokenRefreshWindow = time.Minute
+)
+
+// imdsStatusError is returned for responses with a status code other than 200.
+type imdsStatusError struct {
+	path       string
+	statusCode int
+}
+
+func (e *imdsStatusError) Error() string {
+	return fmt.Sprintf("IMDS request to %s failed with status code %d", e.path, e.statusCode)
+}
+
+func isIMDSStatus(err error, statusCode int) bool {
+	var statusErr *imdsStatusError
+	return errors.As(err, &statusErr) && (statusCode == 0 || statusErr.statusCode == statusCode)
+}
+
+// IMDSClient reads the EC2 instance metadata service. It uses IMDSv2 session tokens,
+// which are cached and refreshed shortly before their TTL runs out, and falls back to
+// IMDSv1 only when configured to.
+type IMDSClient struct {
+	endpoint   string
+	client     *http.Client
+	tokenTTL   time.Duration
+	v1Fallback bool
+	now        func() time.Time
+
+	mutex       sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewIMDSClient returns a client for the endpoint configured with EC2_METADATA_ENDPOINT,
+// http://169.254.169.254 by default, that falls back to IMDSv1 if
+// EC2_METADATA_V1_FALLBACK is true.
+func NewIMDSClient() *IMDSClient {
+	env := config.GetConfig()
+	return &IMDSClient{
+		endpoint:   normalizeIMDSEndpoint(env.EC2MetadataEndpoint),
+		client:     &http.Client{Timeout: defaultIMDSTimeout},
+		tokenTTL:   defaultIMDSTokenTTL,
+		v1Fallback: env.EC2MetadataV1Fallback,
+		now:        time.Now,
+	}
+}
+
+// normalizeIMDSEndpoint accepts a URL as well as a bare host, which may be an IPv6 address
+// without brackets, e.g. fd00:ec2::254.
+func normalizeIMDSEndpoint(endpoint string) string {
+	endpoint = strings.TrimSuffix(strings.TrimSpace(endpoint), "/")
+	if endpoint == "" {
+		return defaultIMDSEndpoint
+	}
+	if strings.Contains(endpoint, "://") {
+		return endpoint
+	}
+	if ip := net.ParseIP(endpoint); ip != nil && ip.To4() == nil {
+		endpoint = "[" + endpoint + "]"
+	}
+	return "http://" + endpoint
+}
+
+// Get returns the body of the given metadata path.
+func (c *IMDSClient) Get(path string) ([]byte, error) {
+	token, err := c.getToken()
+	if err != nil {
+		// only fall back if the service answered, an unreachable service will not answer
+		// IMDSv1 requests either
+		if !c.v1Fallback || !isIMDSStatus(err, 0) {
+			return nil, err
+		}
+		token = ""
+	}
+
+	body, err := c.get(path, token)
+	if isIMDSStatus(err, http.StatusUnauthorized) && token != "" {
+		// the token expired or was revoked before its TTL, retry once with a new one
+		c.invalidateToken()
+		if token, err = c.getToken(); err != nil {
+			return nil, err
+		}
+		body, err = c.get(path, token)
+	}
+	return body, err
+}
+
+// GetJSON decodes the body of the given metadata path into v.
+func (c *IMDSClient) GetJSON(path string, v any) error {
+	body, err := c.Get(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to decode IMDS response of %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *IMDSClient) get(path, token string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, c.endpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set(metadataRequestTokenHeaderKey, token)
+	}
+	return c.do(req, path)
+}
+
+func (c *IMDSClient) getToken() (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.token != "" && c.now().Before(c.tokenExpiry.Add(-tokenRefreshWindow)) {
+		return c.token, nil
+	}
+
+	req, err := http.NewRequest(http.MethodPut, c.endpoint+tokenPath, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(tokenRequestHeaderKey, strconv.Itoa(int(c.tokenTTL.Seconds())))
+	requestedAt := c.now()
+	token, err := c.do(req, tokenPath)
+	if err != nil {
+		return "", err
+	}
+
+	c.token = string(token)
+	c.tokenExpiry = requestedAt.Add(c.tokenTTL)
+	return c.token, nil
+}
+
+func (c *IMDSClient) invalidateToken() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.token = ""
+}
+
+func (c *IMDSClient) do(req *http.Request, path string) ([]byte, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &imdsStatusError{path: path, statusCode: resp.StatusCode}
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,247 @@
+package environments
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeIMDS is a stand-in for the instance metadata service.
+type fakeIMDS struct {
+	mutex         sync.Mutex
+	tokenRequests int
+	tokens        []string
+	ttlHeaders    []string
+	// tokenStatus, if set, is returned for token requests.
+	tokenStatus int
+	// acceptV1 allows requests without a token.
+	acceptV1 bool
+	// revoked tokens are rejected with 401.
+	revoked map[string]bool
+	delay   time.Duration
+	// paths serves additional metadata paths.
+	paths map[string]string
+}
+
+func newFakeIMDS(t *testing.T, imds *fakeIMDS) *httptest.Server {
+	if imds.revoked == nil {
+		imds.revoked = map[string]bool{}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(imds.delay)
+		imds.mutex.Lock()
+		defer imds.mutex.Unlock()
+
+		if r.URL.Path == tokenPath {
+			if r.Method != http.MethodPut {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			if imds.tokenStatus != 0 {
+				w.WriteHeader(imds.tokenStatus)
+				return
+			}
+			imds.tokenRequests++
+			token := "token-" + strconv.Itoa(imds.tokenRequests)
+			imds.tokens = append(imds.tokens, token)
+			imds.ttlHeaders = append(imds.ttlHeaders, r.Header.Get(tokenRequestHeaderKey))
+			w.Write([]byte(token))
+			return
+		}
+
+		token := r.Header.Get(metadataRequestTokenHeaderKey)
+		if (token == "" && !imds.acceptV1) || imds.revoked[token] {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if body, ok := imds.paths[r.URL.Path]; ok {
+			w.Write([]byte(body))
+			return
+		}
+		switch r.URL.Path {
+		case metadataPath:
+			w.Write([]byte(`{"imageId":"ami-1","availabilityZone":"us-west-2b","privateIp":"10.0.0.1","instanceId":"i-1","instanceType":"t3.micro","region":"us-west-2","accountId":"123456789012"}`))
+		case "/latest/meta-data/instance-id":
+			w.Write([]byte("i-1"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("<html>Not Found</html>"))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestIMDSClient(endpoint string) *IMDSClient {
+	client := NewIMDSClient()
+	client.endpoint = endpoint
+	return client
+}
+
+func TestIMDSClientCachesToken(t *testing.T) {
+
+	imds := &fakeIMDS{}
+	client := newTestIMDSClient(newFakeIMDS(t, imds).URL)
+
+	for i := 0; i < 3; i++ {
+		body, err := client.Get("/latest/meta-data/instance-id")
+		if err != nil || string(body) != "i-1" {
+			t.Fatalf("Expected %v, got %v, %v", "i-1", string(body), err)
+		}
+	}
+	if imds.tokenRequests != 1 {
+		t.Errorf("Expected 1 token request, got %d", imds.tokenRequests)
+	}
+	if imds.ttlHeaders[0] != "21600" {
+		t.Errorf("Expected TTL header %v, got %v", "21600", imds.ttlHeaders[0])
+	}
+}
+
+func TestIMDSClientRefreshesTokenBeforeExpiry(t *testing.T) {
+
+	imds := &fakeIMDS{}
+	client := newTestIMDSClient(newFakeIMDS(t, imds).URL)
+	now := time.Now()
+	client.now = func() time.Time { return now }
+
+	client.Get("/latest/meta-data/instance-id")
+	now = now.Add(defaultIMDSTokenTTL - 2*tokenRefreshWindow)
+	client.Get("/latest/meta-data/instance-id")
+	if imds.tokenRequests != 1 {
+		t.Errorf("Expected 1 token request within the TTL, got %d", imds.tokenRequests)
+	}
+
+	now = now.Add(tokenRefreshWindow)
+	client.Get("/latest/meta-data/instance-id")
+	if imds.tokenRequests != 2 {
+		t.Errorf("Expected the token to be refreshed, got %d token requests", imds.tokenRequests)
+	}
+}
+
+func TestIMDSClientRetriesWithNewTokenWhenRejected(t *testing.T) {
+
+	imds := &fakeIMDS{}
+	client := newTestIMDSClient(newFakeIMDS(t, imds).URL)
+	client.Get("/latest/meta-data/instance-id")
+
+	imds.mutex.Lock()
+	imds.revoked[imds.tokens[0]] = true
+	imds.mutex.Unlock()
+
+	body, err := client.Get("/latest/meta-data/instance-id")
+	if err != nil || string(body) != "i-1" {
+		t.Fatalf("Expected %v, got %v, %v", "i-1", string(body), err)
+	}
+	if imds.tokenRequests != 2 {
+		t.Errorf("Expected 2 token requests, got %d", imds.tokenRequests)
+	}
+}
+
+func TestIMDSClientChecksStatusCode(t *testing.T) {
+
+	client := newTestIMDSClient(newFakeIMDS(t, &fakeIMDS{}).URL)
+
+	var v map[string]any
+	err := client.GetJSON("/latest/meta-data/missing", &v)
+	if !isIMDSStatus(err, http.StatusNotFound) {
+		t.Errorf("Expected a 404 status error, got %v", err)
+	}
+}
+
+func TestIMDSClientV1Fallback(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		v1Fallback bool
+		acceptV1   bool
+		expectErr  bool
+	}{
+		{name: "Disabled", v1Fallback: false, acceptV1: true, expectErr: true},
+		{name: "Enabled", v1Fallback: true, acceptV1: true, expectErr: false},
+		{name: "EnabledButRejected", v1Fallback: true, acceptV1: false, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			imds := &fakeIMDS{tokenStatus: http.StatusForbidden, acceptV1: tt.acceptV1}
+			client := newTestIMDSClient(newFakeIMDS(t, imds).URL)
+			client.v1Fallback = tt.v1Fallback
+
+			_, err := client.Get("/latest/meta-data/instance-id")
+			if (err != nil) != tt.expectErr {
+				t.Errorf("Expected error %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestIMDSClientTimesOut(t *testing.T) {
+
+	imds := &fakeIMDS{delay: 200 * time.Millisecond}
+	client := newTestIMDSClient(newFakeIMDS(t, imds).URL)
+	client.client.Timeout = 50 * time.Millisecond
+	client.v1Fallback = true
+
+	start := time.Now()
+	if _, err := client.Get("/latest/meta-data/instance-id"); err == nil {
+		t.Errorf("Expected a timeout error")
+	}
+	// no IMDSv1 attempt after the service did not answer
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("Expected the request to time out after %v, took %v", client.client.Timeout, elapsed)
+	}
+}
+
+func TestNormalizeIMDSEndpoint(t *testing.T) {
+
+	tests := []struct {
+		endpoint string
+		expected string
+	}{
+		{"", "http://169.254.169.254"},
+		{"http://localhost:1338/", "http://localhost:1338"},
+		{"localhost:1338", "http://localhost:1338"},
+		{"169.254.169.254", "http://169.254.169.254"},
+		{"fd00:ec2::254", "http://[fd00:ec2::254]"},
+		{"http://[fd00:ec2::254]", "http://[fd00:ec2::254]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			if result := normalizeIMDSEndpoint(tt.endpoint); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestEC2EnvironmentProbeWithConfiguredEndpoint(t *testing.T) {
+
+	server := newFakeIMDS(t, &fakeIMDS{})
+	t.Setenv("AWS_EMF_EC2_METADATA_ENDPOINT", server.URL)
+
+	env := &EC2Environment{}
+	if !env.Probe() {
+		t.Fatalf("Expected probe to succeed")
+	}
+	if env.metadata.InstanceId != "i-1" {
+		t.Errorf("Expected %v, got %v", "i-1", env.metadata.InstanceId)
+	}
+	if env.GetType() != "AWS::EC2::Instance" {
+		t.Errorf("Expected %v, got %v", "AWS::EC2::Instance", env.GetType())
+	}
+}
+
+func TestEC2EnvironmentProbeFailsOnErrorStatus(t *testing.T) {
+
+	server := newFakeIMDS(t, &fakeIMDS{tokenStatus: http.StatusNotFound})
+	t.Setenv("AWS_EMF_EC2_METADATA_ENDPOINT", server.URL)
+
+	env := &EC2Environment{}
+	if env.Probe() {
+		t.Errorf("Expected probe to fail")
+	}
+}
@@ -0,0 +1,195 @@
+package environments
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/config"
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/context"
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/sinks"
+)
+
+const (
+	defaultServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// defaultPodInfoDir is where the downward API volume is conventionally mounted.
+	defaultPodInfoDir = "/etc/podinfo"
+)
+
+type KubernetesMetadata struct {
+	PodName       string
+	Namespace     string
+	NodeName      string
+	ContainerName string
+	Labels        map[string]string
+}
+
+// KubernetesEnvironment detects pods, e.g. on EKS. The pod metadata is read from the
+// POD_NAME, POD_NAMESPACE, NODE_NAME, CONTAINER_NAME and POD_LABELS variables, which are
+// usually populated through the downward API, from the name, namespace and labels files
+// of a downward API volume and from the service account.
+type KubernetesEnvironment struct {
+	sinkCache
+	metadata          *KubernetesMetadata
+	serviceAccountDir string
+	podInfoDir        string
+	probeErr          error
+	mutex             sync.Mutex
+}
+
+func NewKubernetesEnvironment() (*KubernetesEnvironment, error) {
+	k8s := &KubernetesEnvironment{}
+	if !k8s.Probe() {
+		return nil, errors.New("failed to probe Kubernetes environment")
+	}
+	return k8s, nil
+}
+
+func (e *KubernetesEnvironment) Probe() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	serviceAccountDir := e.getServiceAccountDir()
+	_, err := os.Stat(serviceAccountDir)
+	if os.Getenv("KUBERNETES_SERVICE_HOST") == "" && err != nil {
+		e.probeErr = fmt.Errorf("KUBERNETES_SERVICE_HOST is not set and %w", err)
+		return false
+	}
+	e.probeErr = nil
+
+	e.metadata = e.collectMetadata(serviceAccountDir)
+	log.Println("Successfully collected Kubernetes pod metadata.")
+	return true
+}
+
+func (e *KubernetesEnvironment) collectMetadata(serviceAccountDir string) *KubernetesMetadata {
+	podInfoDir := e.getPodInfoDir()
+	metadata := &KubernetesMetadata{
+		PodName:       firstNonEmpty(os.Getenv("POD_NAME"), readFile(podInfoDir, "name")),
+		Namespace:     firstNonEmpty(os.Getenv("POD_NAMESPACE"), readFile(podInfoDir, "namespace"), readFile(serviceAccountDir, "namespace")),
+		NodeName:      os.Getenv("NODE_NAME"),
+		ContainerName: os.Getenv("CONTAINER_NAME"),
+		Labels:        map[string]string{},
+	}
+	if metadata.PodName == "" {
+		// the hostname of a pod is its name unless spec.hostname is set
+		metadata.PodName, _ = os.Hostname()
+	}
+
+	labels := parseLabels(readFile(podInfoDir, "labels"))
+	for key, value := range parseLabels(os.Getenv("POD_LABELS")) {
+		labels[key] = value
+	}
+	for _, key := range config.GetConfig().KubernetesLabels {
+		if value, ok := labels[key]; ok {
+			metadata.Labels[key] = value
+		}
+	}
+	return metadata
+}
+
+// ProbeError tells why the last probe failed.
+func (e *KubernetesEnvironment) ProbeError() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.probeErr
+}
+
+func (e *KubernetesEnvironment) GetName() string {
+	env := config.GetConfig()
+	if env.ServiceName != "" {
+		return env.ServiceName
+	}
+	if e.metadata != nil && e.metadata.ContainerName != "" {
+		return e.metadata.ContainerName
+	}
+	return "Unknown"
+}
+
+func (e *KubernetesEnvironment) GetType() string {
+	return "AWS::EKS::Pod"
+}
+
+func (e *KubernetesEnvironment) GetLogGroupName() string {
+	return agentLogGroupName(e.GetName() + "-metrics")
+}
+
+func (e *KubernetesEnvironment) ConfigureContext(ctx *context.MetricsContext) {
+	if e.metadata == nil {
+		return
+	}
+	e.addProperty(ctx, "podName", e.metadata.PodName)
+	e.addProperty(ctx, "namespace", e.metadata.Namespace)
+	e.addProperty(ctx, "nodeName", e.metadata.NodeName)
+	e.addProperty(ctx, "containerName", e.metadata.ContainerName)
+	if len(e.metadata.Labels) > 0 {
+		ctx.SetProperty("labels", e.metadata.Labels)
+	}
+}
+
+func (e *KubernetesEnvironment) GetSink() sinks.Sink {
+	return e.getSink(func() sinks.Sink {
+		env := config.GetConfig()
+		return sinks.NewAgentSink(e.GetLogGroupName(), env.LogStreamName)
+	})
+}
+
+func (e *KubernetesEnvironment) addProperty(ctx *context.MetricsContext, key, value string) {
+	if value != "" {
+		ctx.SetProperty(key, value)
+	}
+}
+
+func (e *KubernetesEnvironment) getServiceAccountDir() string {
+	if e.serviceAccountDir != "" {
+		return e.serviceAccountDir
+	}
+	return defaultServiceAccountDir
+}
+
+func (e *KubernetesEnvironment) getPodInfoDir() string {
+	if e.podInfoDir != "" {
+		return e.podInfoDir
+	}
+	return defaultPodInfoDir
+}
+
+func readFile(dir, name string) string {
+	content, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// parseLabels parses labels in the format of the downward API labels file, one key="value"
+// per line. Commas are accepted as separators as well, so the same format can be used in
+// a single environment variable.
+func parseLabels(value string) map[string]string {
+	labels := map[string]string{}
+	for _, line := range strings.FieldsFunc(value, func(r rune) bool { return r == '\n' || r == ',' }) {
+		key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+		if !found || key == "" {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		labels[key] = value
+	}
+	return labels
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
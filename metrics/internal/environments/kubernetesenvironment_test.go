@@ -0,0 +1,158 @@
+package environments
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/context"
+)
+
+// newTestKubernetesEnvironment returns an environment reading from temporary service
+// account and downward API directories with the given files.
+func newTestKubernetesEnvironment(t *testing.T, serviceAccountFiles, podInfoFiles map[string]string) *KubernetesEnvironment {
+	t.Helper()
+
+	env := &KubernetesEnvironment{
+		serviceAccountDir: writeFiles(t, serviceAccountFiles),
+		podInfoDir:        writeFiles(t, podInfoFiles),
+	}
+	for _, key := range []string{"KUBERNETES_SERVICE_HOST", "POD_NAME", "POD_NAMESPACE", "NODE_NAME", "CONTAINER_NAME", "POD_LABELS", "SERVICE_NAME", "AWS_EMF_SERVICE_NAME", "AWS_EMF_KUBERNETES_LABELS"} {
+		t.Setenv(key, "")
+	}
+	return env
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	if files == nil {
+		return filepath.Join(t.TempDir(), "missing")
+	}
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestKubernetesEnvironmentProbe(t *testing.T) {
+
+	tests := []struct {
+		name                string
+		serviceHost         string
+		serviceAccountFiles map[string]string
+		expected            bool
+	}{
+		{name: "ServiceHost", serviceHost: "10.100.0.1", expected: true},
+		{name: "ServiceAccount", serviceAccountFiles: map[string]string{"namespace": "default"}, expected: true},
+		{name: "NotKubernetes", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestKubernetesEnvironment(t, tt.serviceAccountFiles, nil)
+			t.Setenv("KUBERNETES_SERVICE_HOST", tt.serviceHost)
+
+			if result := env.Probe(); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestKubernetesEnvironmentConfigureContextFromFiles(t *testing.T) {
+
+	env := newTestKubernetesEnvironment(t,
+		map[string]string{"namespace": "from-service-account"},
+		map[string]string{
+			"name":      "checkout-5d8f7-abcde\n",
+			"namespace": "shop\n",
+			"labels":    "app=\"checkout\"\npod-template-hash=\"5d8f7\"\nteam=\"payments\"\n",
+		},
+	)
+	t.Setenv("NODE_NAME", "ip-10-0-1-23.ec2.internal")
+	t.Setenv("CONTAINER_NAME", "checkout")
+	t.Setenv("AWS_EMF_KUBERNETES_LABELS", "app, team, missing")
+
+	if !env.Probe() {
+		t.Fatalf("Expected probe to succeed")
+	}
+	ctx := context.Empty()
+	env.ConfigureContext(&ctx)
+
+	expected := map[string]any{
+		"podName":       "checkout-5d8f7-abcde",
+		"namespace":     "shop",
+		"nodeName":      "ip-10-0-1-23.ec2.internal",
+		"containerName": "checkout",
+		"labels":        map[string]string{"app": "checkout", "team": "payments"},
+	}
+	if !reflect.DeepEqual(ctx.Properties, expected) {
+		t.Errorf("Expected %v, got %v", expected, ctx.Properties)
+	}
+	if env.GetName() != "checkout" {
+		t.Errorf("Expected %v, got %v", "checkout", env.GetName())
+	}
+	if env.GetLogGroupName() != "checkout-metrics" {
+		t.Errorf("Expected %v, got %v", "checkout-metrics", env.GetLogGroupName())
+	}
+}
+
+func TestKubernetesEnvironmentConfigureContextFromEnv(t *testing.T) {
+
+	env := newTestKubernetesEnvironment(t, map[string]string{"namespace": "from-service-account"}, nil)
+	t.Setenv("POD_NAME", "worker-0")
+	t.Setenv("POD_LABELS", "app=worker,tier=\"batch\"")
+	t.Setenv("AWS_EMF_KUBERNETES_LABELS", "tier")
+
+	if !env.Probe() {
+		t.Fatalf("Expected probe to succeed")
+	}
+	ctx := context.Empty()
+	env.ConfigureContext(&ctx)
+
+	expected := map[string]any{
+		"podName":   "worker-0",
+		"namespace": "from-service-account",
+		"labels":    map[string]string{"tier": "batch"},
+	}
+	if !reflect.DeepEqual(ctx.Properties, expected) {
+		t.Errorf("Expected %v, got %v", expected, ctx.Properties)
+	}
+	if env.GetName() != "Unknown" {
+		t.Errorf("Expected %v, got %v", "Unknown", env.GetName())
+	}
+}
+
+func TestKubernetesEnvironmentGetType(t *testing.T) {
+
+	env := &KubernetesEnvironment{}
+	result := env.GetType()
+
+	if result != "AWS::EKS::Pod" {
+		t.Errorf("Expected AWS::EKS::Pod, got %v", result)
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+
+	tests := []struct {
+		value    string
+		expected map[string]string
+	}{
+		{"", map[string]string{}},
+		{"app=\"web\"\nversion=\"1.2\"", map[string]string{"app": "web", "version": "1.2"}},
+		{"app=web, version=1.2", map[string]string{"app": "web", "version": "1.2"}},
+		{"invalid\n=value\nkey=", map[string]string{"key": ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if result := parseLabels(tt.value); !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package environments
 
 import (
+	"errors"
 	"os"
 	"strings"
 
@@ -9,13 +10,18 @@ import (
 )
 
 type LambdaEnvironment struct {
-	sink sinks.Sink
+	sinkCache
 }
 
 func (e *LambdaEnvironment) Probe() bool {
 	return os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != ""
 }
 
+// ProbeError tells why the probe fails.
+func (e *LambdaEnvironment) ProbeError() error {
+	return errors.New("AWS_LAMBDA_FUNCTION_NAME is not set")
+}
+
 func (e *LambdaEnvironment) GetName() string {
 	name := os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
 	if name != "" {
@@ -44,10 +50,9 @@ func (e *LambdaEnvironment) ConfigureContext(ctx *context.MetricsContext) {
 }
 
 func (e *LambdaEnvironment) GetSink() sinks.Sink {
-	if e.sink == nil {
-		e.sink = sinks.NewConsoleSink()
-	}
-	return e.sink
+	return e.getSink(func() sinks.Sink {
+		return sinks.NewConsoleSink()
+	})
 }
 
 func (e *LambdaEnvironment) addProperty(ctx *context.MetricsContext, key, value string) {
@@ -9,7 +9,7 @@ import (
 )
 
 type LocalEnvironment struct {
-	sink sinks.Sink
+	sinkCache
 }
 
 func (e *LocalEnvironment) Probe() bool {
@@ -47,8 +47,7 @@ func (e *LocalEnvironment) ConfigureContext(ctx *context.MetricsContext) {
 }
 
 func (e *LocalEnvironment) GetSink() sinks.Sink {
-	if e.sink == nil {
-		e.sink = sinks.NewConsoleSink()
-	}
-	return e.sink
+	return e.getSink(func() sinks.Sink {
+		return sinks.NewConsoleSink()
+	})
 }
@@ -63,7 +63,12 @@ func parseEndpoint(endpoint string) Endpoint {
 
 func NewAgentSink(logGroupName, logStreamName string) *AgentSink {
 	env := config.GetConfig()
-	endpoint := parseEndpoint(env.AgentEndpoint)
+	agentEndpoint := env.AgentEndpoint
+	if env.FluentBitEnabled() {
+		agentEndpoint = env.FluentBitEndpoint()
+		log.Printf("Using Fluent Bit endpoint: %s", agentEndpoint)
+	}
+	endpoint := parseEndpoint(agentEndpoint)
 	sink := &AgentSink{
 		name:          "AgentSink",
 		logGroupName:  logGroupName,
@@ -110,6 +115,12 @@ func (s *AgentSink) LogGroupName() string {
 	return s.logGroupName
 }
 
+func (s *AgentSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.SocketClient.Close()
+}
+
 func getSocketClient(endpoint Endpoint) SocketClient {
 	log.Printf("Getting socket client for connection: %v", endpoint)
 	var client SocketClient
@@ -35,3 +35,7 @@ func (s *ConsoleSink) Name() string {
 func (s *ConsoleSink) LogGroupName() string {
 	return ""
 }
+
+func (s *ConsoleSink) Close() error {
+	return nil
+}
@@ -6,10 +6,14 @@ type Sink interface {
 	Accept(context *context.MetricsContext) error
 	Name() string
 	LogGroupName() string
+	// Close releases the connections of the sink.
+	Close() error
 }
 
 type SocketClient interface {
 	SendMessage(message []byte) error
+	// Close closes the connection, a later message opens a new one.
+	Close() error
 }
 
 type Endpoint struct {
@@ -26,9 +26,10 @@ func NewTcpClient(endpoint Endpoint) *TcpClient {
 func (c *TcpClient) InitialConnect() error {
 
 	var err error
-	addr := fmt.Sprintf("%s:%s", c.Endpoint.Host, c.Endpoint.Port)
+	addr := net.JoinHostPort(c.Endpoint.Host, c.Endpoint.Port)
 	for i := 0; i < maxRetries; i++ {
-		conn, err := net.Dial("tcp", addr)
+		var conn net.Conn
+		conn, err = net.Dial("tcp", addr)
 		if err == nil {
 			c.Conn = conn
 			log.Printf("TcpClient connected to %s", addr)
@@ -69,6 +70,19 @@ func (c *TcpClient) Disconnect(reason string) {
 	}
 }
 
+// Close closes the connection to the agent, the next message reconnects.
+func (c *TcpClient) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.Conn == nil {
+		return nil
+	}
+	err := c.Conn.Close()
+	c.Conn = nil
+	return err
+}
+
 func (c *TcpClient) waitForOpenConnection() error {
 	if c.Conn == nil {
 		return c.establishConnection()
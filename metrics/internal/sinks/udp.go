@@ -36,3 +36,8 @@ func (u *UdpClient) SendMessage(message []byte) error {
 	log.Println("Message sent via UDP.")
 	return nil
 }
+
+// Close is a no-op, every message is sent over its own connection.
+func (u *UdpClient) Close() error {
+	return nil
+}
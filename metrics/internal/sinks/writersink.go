@@ -0,0 +1,52 @@
+package sinks
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/context"
+)
+
+// WriterSink writes every event as a line to a writer, e.g. a file or a buffer in tests.
+type WriterSink struct {
+	name   string
+	writer io.Writer
+	mutex  sync.Mutex
+}
+
+func NewWriterSink(writer io.Writer) *WriterSink {
+	return &WriterSink{
+		name:   "WriterSink",
+		writer: writer,
+	}
+}
+
+func (s *WriterSink) Accept(context *context.MetricsContext) error {
+	events, err := context.Serialize()
+	if err != nil {
+		return fmt.Errorf("failed to serialize context: %w", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, event := range events {
+		if _, err := io.WriteString(s.writer, event+"\n"); err != nil {
+			return fmt.Errorf("failed to write event: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *WriterSink) Name() string {
+	return s.name
+}
+
+func (s *WriterSink) LogGroupName() string {
+	return ""
+}
+
+// Close is a no-op, the writer is owned by the caller.
+func (s *WriterSink) Close() error {
+	return nil
+}
@@ -0,0 +1,79 @@
+// Package testutil records the events of loggers in the tests of the integration packages.
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics"
+)
+
+// Events collects the events written by loggers created with NewLogger. Loggers flush
+// from the goroutines of servers, so writes are synchronized.
+type Events struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (e *Events) Write(p []byte) (int, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.buffer.Write(p)
+}
+
+// Flushed returns the events written since the last call.
+func (e *Events) Flushed(t *testing.T) []map[string]any {
+	t.Helper()
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	events := make([]map[string]any, 0)
+	for _, line := range strings.Split(e.buffer.String(), "\n") {
+		if line == "" {
+			continue
+		}
+		var event map[string]any
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("Failed to parse event: %v", err)
+		}
+		events = append(events, event)
+	}
+	e.buffer.Reset()
+	return events
+}
+
+// NewLogger returns a logger that writes its events to events. It uses a fixed
+// environment, so no environment is detected.
+func NewLogger(events *Events) *metrics.MetricsLogger {
+	logger := metrics.CreateMetricsLogger(metrics.WithEnvironment(environment{}), metrics.WithWriter(events))
+	return &logger
+}
+
+type environment struct{}
+
+func (environment) Probe() bool {
+	return false
+}
+
+func (environment) GetName() string {
+	return "test"
+}
+
+func (environment) GetType() string {
+	return "Test"
+}
+
+func (environment) GetLogGroupName() string {
+	return ""
+}
+
+func (environment) GetProperties() map[string]any {
+	return nil
+}
+
+func (environment) GetSinkType() metrics.SinkType {
+	return metrics.ConsoleSink
+}
@@ -23,6 +23,8 @@ const (
 var (
 	VALID_NAMESPACE_REGEX = regexp.MustCompile(`^[a-zA-Z0-9._#:/-]+$`)
 	VALID_DIMENSION_REGEX = regexp.MustCompile(`^[\x00-\x7F]+$`)
+	// DEFAULT_DIMENSION_KEYS are the default dimensions the logger adds on flush.
+	DEFAULT_DIMENSION_KEYS = []string{"ServiceName", "ServiceType", "LogGroup"}
 )
 
 type StorageResolution int
@@ -71,12 +73,15 @@ var Units = []Unit{Seconds, Microseconds, Milliseconds, Bytes, Kilobytes, Megaby
 type Environment string
 
 const (
-	Local   Environment = "Local"
-	Lambda  Environment = "Lambda"
-	Agent   Environment = "Agent"
-	EC2     Environment = "EC2"
-	ECS     Environment = "ECS"
-	Unknown Environment = "Unknown"
+	Local            Environment = "Local"
+	Lambda           Environment = "Lambda"
+	Agent            Environment = "Agent"
+	EC2              Environment = "EC2"
+	ECS              Environment = "ECS"
+	EKS              Environment = "EKS"
+	AppRunner        Environment = "AppRunner"
+	ElasticBeanstalk Environment = "ElasticBeanstalk"
+	Unknown          Environment = "Unknown"
 )
 
-var Environments = []Environment{Local, Lambda, Agent, EC2, ECS, Unknown}
+var Environments = []Environment{Local, Lambda, Agent, EC2, ECS, EKS, AppRunner, ElasticBeanstalk, Unknown}
@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+var unitAliases = map[string]Unit{
+	"s":           Seconds,
+	"sec":         Seconds,
+	"secs":        Seconds,
+	"second":      Seconds,
+	"ms":          Milliseconds,
+	"msec":        Milliseconds,
+	"millisecond": Milliseconds,
+	"us":          Microseconds,
+	"µs":          Microseconds,
+	"μs":          Microseconds,
+	"usec":        Microseconds,
+	"microsecond": Microseconds,
+	"b":           Bytes,
+	"byte":        Bytes,
+	"kb":          Kilobytes,
+	"kilobyte":    Kilobytes,
+	"mb":          Megabytes,
+	"megabyte":    Megabytes,
+	"gb":          Gigabytes,
+	"gigabyte":    Gigabytes,
+	"tb":          Terabytes,
+	"terabyte":    Terabytes,
+	"bit":         Bits,
+	"kbit":        Kilobits,
+	"kilobit":     Kilobits,
+	"mbit":        Megabits,
+	"megabit":     Megabits,
+	"gbit":        Gigabits,
+	"gigabit":     Gigabits,
+	"tbit":        Terabits,
+	"terabit":     Terabits,
+	"%":           Percent,
+	"pct":         Percent,
+	"counts":      Count,
+	"bps":         BitsPerSecond,
+	"kbps":        KilobitsPerSecond,
+	"mbps":        MegabitsPerSecond,
+	"gbps":        GigabitsPerSecond,
+	"tbps":        TerabitsPerSecond,
+	"iops":        CountPerSecond,
+}
+
+var rateUnits = map[Unit]Unit{
+	Bytes:     BytesPerSecond,
+	Kilobytes: KilobytesPerSecond,
+	Megabytes: MegabytesPerSecond,
+	Gigabytes: GigabytesPerSecond,
+	Terabytes: TerabytesPerSecond,
+	Bits:      BitsPerSecond,
+	Kilobits:  KilobitsPerSecond,
+	Megabits:  MegabitsPerSecond,
+	Gigabits:  GigabitsPerSecond,
+	Terabits:  TerabitsPerSecond,
+	Count:     CountPerSecond,
+}
+
+func init() {
+	for _, unit := range Units {
+		unitAliases[strings.ToLower(string(unit))] = unit
+	}
+}
+
+// ParseUnit parses a unit name case-insensitively. Besides the CloudWatch unit names it
+// accepts common abbreviations such as "ms", "kb" or "kbps" and rates written as
+// "<unit>/s", "<unit>/sec" or "<unit>/second".
+func ParseUnit(value string) (Unit, error) {
+	normalized := strings.ToLower(strings.Join(strings.Fields(value), ""))
+	if unit, ok := lookupUnit(normalized); ok {
+		return unit, nil
+	}
+
+	if numerator, denominator, found := strings.Cut(normalized, "/"); found && isSecondAlias(denominator) {
+		if unit, ok := lookupUnit(numerator); ok {
+			if rate, ok := rateUnits[unit]; ok {
+				return rate, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unit %q is not a valid unit", value)
+}
+
+func lookupUnit(value string) (Unit, bool) {
+	if unit, ok := unitAliases[value]; ok {
+		return unit, true
+	}
+	// allow plural forms of the aliases, e.g. "milliseconds" or "bytes"
+	unit, ok := unitAliases[strings.TrimSuffix(value, "s")]
+	return unit, ok && value != ""
+}
+
+func isSecondAlias(value string) bool {
+	unit, ok := lookupUnit(value)
+	return ok && unit == Seconds
+}
+
+// ParseStorageResolution parses "1" or "high" and "60" or "standard", case-insensitively.
+func ParseStorageResolution(value string) (StorageResolution, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "high":
+		return High, nil
+	case "60", "standard":
+		return Standard, nil
+	default:
+		return 0, fmt.Errorf("storage resolution %q is not a valid storage resolution", value)
+	}
+}
+
+func (u *Unit) UnmarshalText(text []byte) error {
+	unit, err := ParseUnit(string(text))
+	if err != nil {
+		return err
+	}
+	*u = unit
+	return nil
+}
+
+func (u *Unit) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("unit must be a JSON string: %w", err)
+	}
+	return u.UnmarshalText([]byte(value))
+}
+
+func (s *StorageResolution) UnmarshalText(text []byte) error {
+	resolution, err := ParseStorageResolution(string(text))
+	if err != nil {
+		return err
+	}
+	*s = resolution
+	return nil
+}
+
+// UnmarshalJSON accepts both the numeric form (1, 60) and the string form ("high", "60").
+func (s *StorageResolution) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		value = string(data)
+	}
+	return s.UnmarshalText([]byte(value))
+}
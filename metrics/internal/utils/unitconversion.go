@@ -0,0 +1,77 @@
+package utils
+
+import "fmt"
+
+type UnitFamily string
+
+const (
+	TimeUnits      UnitFamily = "Time"
+	ByteUnits      UnitFamily = "Bytes"
+	BitUnits       UnitFamily = "Bits"
+	ByteRateUnits  UnitFamily = "Bytes/Second"
+	BitRateUnits   UnitFamily = "Bits/Second"
+	CountUnits     UnitFamily = "Count"
+	CountRateUnits UnitFamily = "Count/Second"
+	PercentUnits   UnitFamily = "Percent"
+	NoneUnits      UnitFamily = "None"
+)
+
+type unitScale struct {
+	family UnitFamily
+	// factor converts a value of the unit into the base unit of its family.
+	factor float64
+}
+
+// Byte based units use binary multiples (1 Kilobyte = 1024 Bytes), bit based units use
+// decimal multiples (1 Kilobit = 1000 Bits).
+var unitScales = map[Unit]unitScale{
+	Seconds:            {TimeUnits, 1e6},
+	Milliseconds:       {TimeUnits, 1e3},
+	Microseconds:       {TimeUnits, 1},
+	Bytes:              {ByteUnits, 1},
+	Kilobytes:          {ByteUnits, 1 << 10},
+	Megabytes:          {ByteUnits, 1 << 20},
+	Gigabytes:          {ByteUnits, 1 << 30},
+	Terabytes:          {ByteUnits, 1 << 40},
+	Bits:               {BitUnits, 1},
+	Kilobits:           {BitUnits, 1e3},
+	Megabits:           {BitUnits, 1e6},
+	Gigabits:           {BitUnits, 1e9},
+	Terabits:           {BitUnits, 1e12},
+	BytesPerSecond:     {ByteRateUnits, 1},
+	KilobytesPerSecond: {ByteRateUnits, 1 << 10},
+	MegabytesPerSecond: {ByteRateUnits, 1 << 20},
+	GigabytesPerSecond: {ByteRateUnits, 1 << 30},
+	TerabytesPerSecond: {ByteRateUnits, 1 << 40},
+	BitsPerSecond:      {BitRateUnits, 1},
+	KilobitsPerSecond:  {BitRateUnits, 1e3},
+	MegabitsPerSecond:  {BitRateUnits, 1e6},
+	GigabitsPerSecond:  {BitRateUnits, 1e9},
+	TerabitsPerSecond:  {BitRateUnits, 1e12},
+	Count:              {CountUnits, 1},
+	CountPerSecond:     {CountRateUnits, 1},
+	Percent:            {PercentUnits, 1},
+	None:               {NoneUnits, 1},
+}
+
+// GetUnitFamily returns the family of the given unit, or an empty family for unknown units.
+func GetUnitFamily(unit Unit) UnitFamily {
+	return unitScales[unit].family
+}
+
+// AreUnitsCompatible reports whether values can be converted between the two units.
+func AreUnitsCompatible(a, b Unit) bool {
+	familyA := GetUnitFamily(a)
+	return familyA != "" && familyA == GetUnitFamily(b)
+}
+
+// ConvertUnit converts value from one unit into another unit of the same family.
+func ConvertUnit(value float64, from, to Unit) (float64, error) {
+	if from == to {
+		return value, nil
+	}
+	if !AreUnitsCompatible(from, to) {
+		return 0, fmt.Errorf("cannot convert unit %s to %s", from, to)
+	}
+	return value * unitScales[from].factor / unitScales[to].factor, nil
+}
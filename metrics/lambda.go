@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+var coldStart atomic.Bool
+
+func init() {
+	coldStart.Store(true)
+}
+
+// WrapHandler wraps an aws-lambda-go handler, e.g. for lambda.Start(metrics.WrapHandler(handler)).
+//
+// Every invocation gets a fresh logger, available to the handler through FromContext, with
+// the RequestId and FunctionArn properties taken from the Lambda context. The first
+// invocation of the execution environment records ColdStart. When the handler returns,
+// its Duration in milliseconds and its Errors count are recorded and the logger is
+// flushed before the wrapper returns. A panicking handler is recorded as an error and the
+// panic is propagated after the flush. The options are applied to the logger of every
+// invocation.
+func WrapHandler[TIn, TOut any](handler func(context.Context, TIn) (TOut, error), options ...LoggerOption) func(context.Context, TIn) (TOut, error) {
+	return func(ctx context.Context, event TIn) (response TOut, err error) {
+		logger := CreateMetricsLogger(options...)
+		if lc, ok := lambdacontext.FromContext(ctx); ok {
+			logger.SetProperty("RequestId", lc.AwsRequestID)
+			logger.SetProperty("FunctionArn", lc.InvokedFunctionArn)
+		}
+		if coldStart.Swap(false) {
+			logger.PutMetric("ColdStart", 1, Count, StorageResolutionStandard)
+		}
+
+		start := time.Now()
+		panicked := true
+		defer func() {
+			logger.PutDuration("Duration", time.Since(start), Milliseconds)
+			errors := 0.0
+			if panicked || err != nil {
+				errors = 1
+			}
+			logger.PutMetric("Errors", errors, Count, StorageResolutionStandard)
+			logger.Flush()
+		}()
+
+		response, err = handler(NewContext(ctx, &logger), event)
+		panicked = false
+		return response, err
+	}
+}
@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+// captureInvocations returns the options that make every invocation write its event to
+// the returned buffer, and makes the next invocation a cold start.
+func captureInvocations() (*bytes.Buffer, []LoggerOption) {
+	var output bytes.Buffer
+	coldStart.Store(true)
+	return &output, []LoggerOption{WithEnvironment(&platformEnvironment{}), WithWriter(&output)}
+}
+
+// invocationEvents parses the events written to output.
+func invocationEvents(t *testing.T, output *bytes.Buffer) []map[string]any {
+	events := make([]map[string]any, 0)
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var event map[string]any
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("Failed to parse event: %v", err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// metricUnit returns the unit a metric was declared with in the directives of an event.
+func metricUnit(event map[string]any, name string) any {
+	for _, directive := range event["_aws"].(map[string]any)["CloudWatchMetrics"].([]any) {
+		for _, metric := range directive.(map[string]any)["Metrics"].([]any) {
+			if metric.(map[string]any)["Name"] == name {
+				return metric.(map[string]any)["Unit"]
+			}
+		}
+	}
+	return nil
+}
+
+func newLambdaContext(requestId string) context.Context {
+	return lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{
+		AwsRequestID:       requestId,
+		InvokedFunctionArn: "arn:aws:lambda:us-east-1:123456789012:function:test",
+	})
+}
+
+func TestWrapHandlerRecordsInvocations(t *testing.T) {
+
+	output, options := captureInvocations()
+	handler := WrapHandler(func(ctx context.Context, event string) (string, error) {
+		FromContext(ctx).PutMetric("Processed", 1, Count, StorageResolutionStandard)
+		if event == "fail" {
+			return "", errors.New("failed")
+		}
+		return "ok:" + event, nil
+	}, options...)
+
+	response, err := handler(newLambdaContext("request-1"), "a")
+	if err != nil || response != "ok:a" {
+		t.Errorf("Expected %v, got %v, %v", "ok:a", response, err)
+	}
+	_, err = handler(newLambdaContext("request-2"), "fail")
+	if err == nil {
+		t.Errorf("Expected the handler error to be returned")
+	}
+
+	events := invocationEvents(t, output)
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 flushed invocations, got %d", len(events))
+	}
+	tests := []struct {
+		requestId string
+		coldStart bool
+		errors    float64
+	}{
+		{requestId: "request-1", coldStart: true, errors: 0},
+		{requestId: "request-2", coldStart: false, errors: 1},
+	}
+	for i, tt := range tests {
+		event := events[i]
+		if event["RequestId"] != tt.requestId {
+			t.Errorf("Expected RequestId %v, got %v", tt.requestId, event["RequestId"])
+		}
+		if event["FunctionArn"] != "arn:aws:lambda:us-east-1:123456789012:function:test" {
+			t.Errorf("Expected FunctionArn, got %v", event["FunctionArn"])
+		}
+		if _, ok := event["ColdStart"]; ok != tt.coldStart {
+			t.Errorf("Expected ColdStart recorded to be %v, got %v", tt.coldStart, ok)
+		}
+		if values, ok := event["Errors"].([]any); !ok || len(values) != 1 || values[0] != tt.errors {
+			t.Errorf("Expected Errors %v, got %v", tt.errors, event["Errors"])
+		}
+		if unit := metricUnit(event, "Duration"); unit != string(Milliseconds) {
+			t.Errorf("Expected Duration in %v, got %v", Milliseconds, unit)
+		}
+		if _, ok := event["Processed"]; !ok {
+			t.Errorf("Expected the metrics of the handler to be flushed")
+		}
+	}
+}
+
+func TestWrapHandlerFlushesOnPanic(t *testing.T) {
+
+	output, options := captureInvocations()
+	handler := WrapHandler(func(ctx context.Context, event any) (any, error) {
+		panic("boom")
+	}, options...)
+
+	func() {
+		defer func() {
+			if recovered := recover(); recovered != "boom" {
+				t.Errorf("Expected the panic to be propagated, got %v", recovered)
+			}
+		}()
+		handler(newLambdaContext("request-1"), nil)
+	}()
+
+	events := invocationEvents(t, output)
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 flushed invocation, got %d", len(events))
+	}
+	if values, ok := events[0]["Errors"].([]any); !ok || len(values) != 1 || values[0] != 1.0 {
+		t.Errorf("Expected Errors %v, got %v", 1, events[0]["Errors"])
+	}
+}
+
+func TestWrapHandlerWithoutLambdaContext(t *testing.T) {
+
+	output, options := captureInvocations()
+	handler := WrapHandler(func(ctx context.Context, event int) (int, error) {
+		return event * 2, nil
+	}, options...)
+
+	if response, _ := handler(context.Background(), 21); response != 42 {
+		t.Errorf("Expected %v, got %v", 42, response)
+	}
+	events := invocationEvents(t, output)
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 flushed invocation, got %d", len(events))
+	}
+	if _, ok := events[0]["RequestId"]; ok {
+		t.Errorf("Expected no RequestId without a Lambda context")
+	}
+}
@@ -1,50 +1,121 @@
 package metrics
 
 import (
+	"io"
 	"log"
 	"log/slog"
 	"os"
+	"sync"
 
 	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/config"
 	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/context"
 	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/environments"
-	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/utils"
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/sinks"
 )
 
 var slogger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
+// A MetricsLogger is safe for concurrent use, so the goroutines of a request can record
+// into the same logger and its event.
 type MetricsLogger struct {
-	context                 context.MetricsContext
+	context context.MetricsContext
+	// environment and sink are only set if they were injected, otherwise every flush uses
+	// the resolved environment and its sink.
 	environment             environments.Environment
+	sink                    sinks.Sink
 	flushPreserveDimensions bool
+	noop                    bool
+	// mutex guards the context, so the goroutines of a request can share the logger. It
+	// is a pointer because loggers are returned by value.
+	mutex *sync.Mutex
 }
 
-func CreateMetricsLogger() MetricsLogger {
-	ctx := context.Empty()
-	environment, err := environments.ResolveEnvironment()
-	if err != nil {
-		log.Println("Error resolving environment: " + err.Error())
+// LoggerOption configures a logger created by CreateMetricsLogger.
+type LoggerOption func(*MetricsLogger)
+
+// WithEnvironment makes the logger use env instead of the resolved environment.
+func WithEnvironment(env Environment) LoggerOption {
+	return func(l *MetricsLogger) {
+		l.environment = &registeredEnvironment{Environment: env}
+	}
+}
+
+// WithWriter makes the logger write its events as lines to w instead of sending them to
+// the sink of its environment, e.g. to inspect them in tests.
+func WithWriter(w io.Writer) LoggerOption {
+	return func(l *MetricsLogger) {
+		l.sink = sinks.NewWriterSink(w)
+	}
+}
+
+func CreateMetricsLogger(options ...LoggerOption) MetricsLogger {
+	logger := MetricsLogger{context.Empty(), nil, nil, true, false, &sync.Mutex{}}
+	for _, option := range options {
+		option(&logger)
+	}
+	if logger.environment == nil {
+		if _, err := environments.ResolveEnvironment(); err != nil {
+			log.Println("Error resolving environment: " + err.Error())
+		}
 	}
-	return MetricsLogger{ctx, environment, true}
+	return logger
 }
 
 func (l *MetricsLogger) Flush() {
-	environment, err := environments.ResolveEnvironment()
-	if err != nil {
-		msg := "Error resolving environment: " + err.Error()
-		slogger.Error(msg)
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.noop {
+		l.context = l.context.CreateCopyWithContext(l.flushPreserveDimensions)
+		return
+	}
+	environment := l.environment
+	if environment == nil {
+		var err error
+		environment, err = environments.ResolveEnvironment()
+		if err != nil {
+			msg := "Error resolving environment: " + err.Error()
+			slogger.Error(msg)
+			return
+		}
 	}
 	l.configureContextForEnvironment(&l.context, environment)
-	sink := environment.GetSink()
-	sink.Accept(&l.context)
+	sink := l.sink
+	if sink == nil {
+		sink = environment.GetSink()
+	}
+	err := sink.Accept(&l.context)
+	if err != nil {
+		slogger.Error("Error flushing metrics: " + err.Error())
+	}
 	l.context = l.context.CreateCopyWithContext(l.flushPreserveDimensions)
 }
 
-func (l *MetricsLogger) SetProperty(key string, value string) {
-	l.context.SetProperty(key, value)
+// Close closes the sink of an environment or writer injected into the logger. Loggers
+// without either share the sink of the resolved environment, which is closed by the
+// package level Close.
+func (l *MetricsLogger) Close() error {
+	if l.sink != nil {
+		return l.sink.Close()
+	}
+	if l.environment != nil {
+		return l.environment.CloseSink()
+	}
+	return nil
+}
+
+func (l *MetricsLogger) SetProperty(key string, value any) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	err := l.context.SetProperty(key, value)
+	if err != nil {
+		slogger.Error(err.Error())
+	}
 }
 
 func (l *MetricsLogger) PutDimensions(dimensions map[string]string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
 	l.context.PutDimensions(dimensions)
 }
 
@@ -53,6 +124,8 @@ func (l *MetricsLogger) SetDimensions(dimensionSetOrSets interface{}, useDefault
 	if len(useDefault) > 0 {
 		defaultValue = useDefault[0]
 	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
 
 	switch v := dimensionSetOrSets.(type) {
 	case []map[string]string:
@@ -71,30 +144,76 @@ func (l *MetricsLogger) SetDimensions(dimensionSetOrSets interface{}, useDefault
 }
 
 func (l *MetricsLogger) ResetDimensions(useDefault bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
 	l.context.ResetDimensions(useDefault)
 }
 
-func (l *MetricsLogger) PutMetric(key string, value float64, unit utils.Unit, storageResolution utils.StorageResolution) {
-	err := l.context.PutMetric(key, value, unit, storageResolution)
+// PutEmptyDimensionSet additionally publishes every metric without any dimensions
+// ("Dimensions": [[]]), e.g. as a service wide aggregate next to per operation dimensions.
+func (l *MetricsLogger) PutEmptyDimensionSet() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.context.PutEmptyDimensionSet()
+}
+
+func (l *MetricsLogger) PutMetric(key string, value float64, unit Unit, storageResolution StorageResolution, options ...MetricOption) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	err := l.context.PutMetricWithDirective(key, value, unit, storageResolution, newMetricDirective(options))
 	if err != nil {
 		slogger.Error(err.Error())
 	}
 }
 
 func (l *MetricsLogger) SetNamespace(value string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
 	l.context.SetNamespace(value)
 }
 
 func (l *MetricsLogger) SetTimestamp(value int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
 	l.context.SetTimestamp(value)
 }
 
 func (l *MetricsLogger) New() *MetricsLogger {
-	environment, err := environments.ResolveEnvironment()
-	if err != nil {
-		log.Println("Error resolving environment: " + err.Error())
+	if !l.noop && l.environment == nil {
+		if _, err := environments.ResolveEnvironment(); err != nil {
+			log.Println("Error resolving environment: " + err.Error())
+		}
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.noop {
+		return &MetricsLogger{l.context.CreateCopyWithContext(true), nil, nil, true, true, &sync.Mutex{}}
+	}
+	return &MetricsLogger{l.context.CreateCopyWithContext(true), l.environment, l.sink, true, false, &sync.Mutex{}}
+}
+
+// With returns a child logger with its own copy of the properties and dimensions of this
+// logger. The given dimensions are added to every dimension set of the child and the given
+// properties are set on it. Changes to the child never affect this logger, and the child
+// is flushed independently.
+func (l *MetricsLogger) With(dimensions map[string]string, properties ...map[string]any) *MetricsLogger {
+	l.mutex.Lock()
+	child := &MetricsLogger{l.context.CreateCopyWithContext(l.context.ShouldUseDefaultDimensions()), l.environment, l.sink, l.flushPreserveDimensions, l.noop, &sync.Mutex{}}
+	l.mutex.Unlock()
+
+	if len(dimensions) > 0 {
+		err := child.context.LayerDimensions(dimensions)
+		if err != nil {
+			slogger.Error(err.Error())
+		}
 	}
-	return &MetricsLogger{l.context.CreateCopyWithContext(true), environment, true}
+	for _, props := range properties {
+		for key, value := range props {
+			child.SetProperty(key, value)
+		}
+	}
+	return child
 }
 
 func (l *MetricsLogger) configureContextForEnvironment(context *context.MetricsContext, environment environments.Environment) {
@@ -109,10 +228,13 @@ func (l *MetricsLogger) configureContextForEnvironment(context *context.MetricsC
 	}
 
 	defaultDimensions := map[string]string{
-		"LogGroup":    environment.GetLogGroupName(),
 		"ServiceName": serviceName,
 		"ServiceType": serviceType,
 	}
+	// no log group in the Fluent Bit mode, where the Fluent Bit output chooses it
+	if logGroupName := environment.GetLogGroupName(); logGroupName != "" {
+		defaultDimensions["LogGroup"] = logGroupName
+	}
 	context.SetDefaultDimensions(defaultDimensions)
 	environment.ConfigureContext(context)
 }
@@ -1,8 +1,19 @@
 package metrics
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
 	"os"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/utils"
 )
 
 func TestIntegration(t *testing.T) {
@@ -19,3 +30,238 @@ func TestIntegration(t *testing.T) {
 	logger.PutMetric("test1", 1.0, Count, StorageResolutionStandard)
 	logger.Flush()
 }
+
+func TestWithCreatesIsolatedChildLogger(t *testing.T) {
+
+	parent := newTestLogger()
+	parent.PutDimensions(map[string]string{"Service": "api"})
+	parent.SetProperty("Version", "1.0")
+
+	child := parent.With(map[string]string{"Operation": "Get"}, map[string]any{"RequestId": "abc"})
+	child.SetProperty("Attempt", 2)
+	child.PutMetric("Latency", 1, Milliseconds, StorageResolutionStandard)
+
+	expectedChildDimensions := []map[string]string{{"Service": "api", "Operation": "Get"}}
+	if !utils.AreArrayMapsEqual(expectedChildDimensions, child.context.GetDimensions()) {
+		t.Errorf("Expected %v, got %v", expectedChildDimensions, child.context.GetDimensions())
+	}
+	if child.context.Properties["Version"] != "1.0" || child.context.Properties["RequestId"] != "abc" {
+		t.Errorf("Expected inherited and new properties, got %v", child.context.Properties)
+	}
+
+	expectedParentDimensions := []map[string]string{{"Service": "api"}}
+	if !utils.AreArrayMapsEqual(expectedParentDimensions, parent.context.GetDimensions()) {
+		t.Errorf("Expected %v, got %v", expectedParentDimensions, parent.context.GetDimensions())
+	}
+	if len(parent.context.Properties) != 1 {
+		t.Errorf("Expected %v, got %v", 1, parent.context.Properties)
+	}
+	if len(parent.context.Metrics) != 0 {
+		t.Errorf("Expected no metrics, got %v", parent.context.Metrics)
+	}
+}
+
+func TestNewDoesNotShareStateWithParent(t *testing.T) {
+
+	parent := newTestLogger()
+	parent.PutDimensions(map[string]string{"Service": "api"})
+
+	child := parent.New()
+	child.SetProperty("RequestId", "abc")
+	child.PutDimensions(map[string]string{"Operation": "Get"})
+
+	if len(parent.context.Properties) != 0 || len(parent.context.GetDimensions()) != 1 {
+		t.Errorf("Expected the parent to be unchanged, got %v and %v", parent.context.Properties, parent.context.GetDimensions())
+	}
+}
+
+func TestWithWriter(t *testing.T) {
+
+	var output bytes.Buffer
+	logger := CreateMetricsLogger(WithEnvironment(&platformEnvironment{}), WithWriter(&output))
+	logger.PutMetric("Orders", 1, Count, StorageResolutionStandard)
+	logger.Flush()
+
+	child := logger.With(map[string]string{"Operation": "Checkout"})
+	child.PutMetric("Orders", 2, Count, StorageResolutionStandard)
+	child.Flush()
+
+	events := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %v", events)
+	}
+	for _, expected := range []string{`"cell":"cell-1"`, `"ServiceType":"Acme::Platform::App"`} {
+		if !strings.Contains(events[0], expected) {
+			t.Errorf("Expected %s in the event, got %s", expected, events[0])
+		}
+	}
+	if !strings.Contains(events[1], `"Operation":"Checkout"`) {
+		t.Errorf("Expected the child event to be written to the writer, got %s", events[1])
+	}
+}
+
+func TestPropertyWithDefaultDimensionKeyIsRejected(t *testing.T) {
+
+	var output bytes.Buffer
+	logger := CreateMetricsLogger(WithEnvironment(&platformEnvironment{}), WithWriter(&output))
+	for _, key := range []string{"ServiceName", "ServiceType", "LogGroup"} {
+		logger.SetProperty(key, "property")
+	}
+	logger.PutMetric("Orders", 1, Count, StorageResolutionStandard)
+	logger.Flush()
+
+	var event struct {
+		Aws struct {
+			CloudWatchMetrics []struct {
+				Dimensions [][]string
+			}
+		} `json:"_aws"`
+		ServiceName string
+		ServiceType string
+		LogGroup    string
+	}
+	if err := json.Unmarshal(output.Bytes(), &event); err != nil {
+		t.Fatalf("Failed to decode %s: %v", output.String(), err)
+	}
+	if event.ServiceName != "checkout" || event.ServiceType != "Acme::Platform::App" || event.LogGroup != "/acme/checkout" {
+		t.Errorf("Expected the default dimension values, got %s", output.String())
+	}
+	expected := [][]string{{"LogGroup", "ServiceName", "ServiceType"}}
+	dimensions := event.Aws.CloudWatchMetrics[0].Dimensions
+	for _, dimensionSet := range dimensions {
+		sort.Strings(dimensionSet)
+	}
+	if !reflect.DeepEqual(dimensions, expected) {
+		t.Errorf("Expected %v, got %v", expected, dimensions)
+	}
+}
+
+type agentPlatformEnvironment struct {
+	*platformEnvironment
+}
+
+func (e agentPlatformEnvironment) GetSinkType() SinkType {
+	return AgentSink
+}
+
+// newAgentStandIn listens like the CloudWatch agent or the EMF input of Fluent Bit and
+// returns the accepted connections.
+func newAgentStandIn(t *testing.T) (net.Addr, <-chan net.Conn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	connections := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+			connections <- conn
+		}
+	}()
+	return listener.Addr(), connections
+}
+
+func TestCloseReconnectsOnNextFlush(t *testing.T) {
+
+	addr, connections := newAgentStandIn(t)
+	t.Setenv("AWS_EMF_AGENT_ENDPOINT", "tcp://"+addr.String())
+
+	logger := CreateMetricsLogger(WithEnvironment(agentPlatformEnvironment{&platformEnvironment{}}))
+	accept := func() *bufio.Reader {
+		logger.PutMetric("Orders", 1, Count, StorageResolutionStandard)
+		logger.Flush()
+		select {
+		case conn := <-connections:
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			reader := bufio.NewReader(conn)
+			if event, err := reader.ReadString('\n'); err != nil || !strings.Contains(event, `"Orders"`) {
+				t.Fatalf("Expected an event, got %v, %v", event, err)
+			}
+			return reader
+		case <-time.After(time.Second):
+			t.Fatalf("Expected the logger to connect to the agent")
+			return nil
+		}
+	}
+
+	first := accept()
+	if err := logger.Close(); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if _, err := first.ReadString('\n'); err != io.EOF {
+		t.Errorf("Expected the connection to be closed, got %v", err)
+	}
+	accept()
+}
+
+func TestFluentBitMode(t *testing.T) {
+
+	addr, connections := newAgentStandIn(t)
+	t.Cleanup(func() {
+		Reset()
+	})
+	host, port, _ := net.SplitHostPort(addr.String())
+	t.Setenv("AWS_EMF_ENVIRONMENT", "Agent")
+	t.Setenv("AWS_EMF_AGENT_ENDPOINT", "")
+	t.Setenv("FLUENT_HOST", host)
+	t.Setenv("AWS_EMF_FLUENT_BIT_PORT", port)
+	t.Setenv("AWS_EMF_SERVICE_NAME", "checkout")
+	t.Setenv("AWS_EMF_SERVICE_TYPE", "AWS::EKS::Pod")
+	t.Setenv("AWS_EMF_LOG_GROUP_NAME", "checkout-metrics")
+	Reset()
+
+	info := ResolvedEnvironment()
+	if info.LogGroupName != "" || info.SinkEndpoint != "tcp://"+addr.String() {
+		t.Errorf("Expected no log group and the Fluent Bit endpoint, got %v", info)
+	}
+
+	logger := CreateMetricsLogger()
+	logger.PutMetric("Orders", 1, Count, StorageResolutionStandard)
+	logger.Flush()
+
+	var conn net.Conn
+	select {
+	case conn = <-connections:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the logger to connect to Fluent Bit")
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Expected an event, got %v", err)
+	}
+
+	var event struct {
+		Aws struct {
+			LogGroupName      string
+			CloudWatchMetrics []struct {
+				Dimensions [][]string
+			}
+		} `json:"_aws"`
+		LogGroup    string
+		ServiceName string
+		ServiceType string
+	}
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		t.Fatalf("Failed to decode %s: %v", line, err)
+	}
+	if event.Aws.LogGroupName != "" || event.LogGroup != "" {
+		t.Errorf("Expected no log group, got %s", line)
+	}
+	if event.ServiceName != "checkout" || event.ServiceType != "AWS::EKS::Pod" {
+		t.Errorf("Expected the service dimensions, got %s", line)
+	}
+	expected := [][]string{{"ServiceName", "ServiceType"}}
+	dimensions := event.Aws.CloudWatchMetrics[0].Dimensions
+	for _, dimensionSet := range dimensions {
+		sort.Strings(dimensionSet)
+	}
+	if !reflect.DeepEqual(dimensions, expected) {
+		t.Errorf("Expected %v, got %v", expected, dimensions)
+	}
+}
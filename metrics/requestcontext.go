@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+
+	metricscontext "github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/context"
+)
+
+type loggerContextKey struct{}
+
+// NewContext returns a copy of ctx that carries the given logger.
+func NewContext(ctx context.Context, logger *MetricsLogger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx. If ctx carries no logger, a no-op logger
+// is returned, so callers can always record metrics without checking for nil. A no-op
+// logger never resolves the environment and discards everything on Flush.
+//
+// Every goroutine using ctx shares the returned logger. It is safe for concurrent use, but
+// a Flush by one goroutine also flushes what the others recorded so far, so only the owner
+// of the logger, e.g. the middleware that created it, should flush it.
+func FromContext(ctx context.Context) *MetricsLogger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerContextKey{}).(*MetricsLogger); ok && logger != nil {
+			return logger
+		}
+	}
+	return newNoopLogger()
+}
+
+func newNoopLogger() *MetricsLogger {
+	return &MetricsLogger{metricscontext.Empty(), nil, nil, true, true, &sync.Mutex{}}
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFromContextReturnsLoggerFromNewContext(t *testing.T) {
+
+	logger := newTestLogger()
+	ctx := NewContext(context.Background(), logger)
+
+	result := FromContext(ctx)
+	result.PutMetric("Requests", 1, Count, StorageResolutionStandard)
+
+	if result != logger {
+		t.Errorf("Expected %p, got %p", logger, result)
+	}
+	if len(logger.context.Metrics["Requests"].Values) != 1 {
+		t.Errorf("Expected the metric to be recorded on the request logger")
+	}
+}
+
+func TestFromContextWithoutLoggerReturnsNoopLogger(t *testing.T) {
+
+	for name, ctx := range map[string]context.Context{
+		"Background": context.Background(),
+		"Nil logger": NewContext(context.Background(), nil),
+	} {
+		t.Run(name, func(t *testing.T) {
+			logger := FromContext(ctx)
+			if logger == nil || !logger.noop {
+				t.Fatalf("Expected a no-op logger, got %v", logger)
+			}
+
+			logger.PutMetric("Requests", 1, Count, StorageResolutionStandard)
+			logger.Flush()
+
+			if len(logger.context.Metrics) != 0 {
+				t.Errorf("Expected flush to discard metrics, got %v", logger.context.Metrics)
+			}
+		})
+	}
+}
+
+func TestNoopLoggerChildrenAreNoop(t *testing.T) {
+
+	logger := FromContext(context.Background())
+
+	if !logger.New().noop || !logger.With(map[string]string{"Operation": "Get"}).noop {
+		t.Errorf("Expected children of a no-op logger to be no-op loggers")
+	}
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/config"
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/environments"
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/sinks"
+)
+
+// ProbeResult is the outcome of a single environment probe.
+type ProbeResult struct {
+	Name     string
+	Priority int
+	// Matched is set for the probe that won.
+	Matched bool
+	// Reason tells why the probe did not match, e.g. "disabled by configuration" or
+	// "timed out".
+	Reason   string
+	Duration time.Duration
+}
+
+// EnvironmentInfo describes the environment the loggers write to and how it was resolved.
+type EnvironmentInfo struct {
+	// Name and Type are used for the ServiceName and ServiceType dimensions.
+	Name          string
+	Type          string
+	LogGroupName  string
+	LogStreamName string
+	SinkType      SinkType
+	// SinkEndpoint is the agent endpoint, e.g. tcp://0.0.0.0:25888, and empty for the
+	// console sink.
+	SinkEndpoint string
+	// Override is the ENVIRONMENT config if it was applied instead of the discovery.
+	Override string
+	// Probes are the results of the discovery in probe order, empty if the environment was
+	// overridden.
+	Probes            []ProbeResult
+	DiscoveryDuration time.Duration
+}
+
+// ResolvedEnvironment returns the environment the loggers write to, resolving it first if
+// no logger was created yet.
+func ResolvedEnvironment() EnvironmentInfo {
+	environment, err := environments.ResolveEnvironment()
+	if err != nil {
+		return EnvironmentInfo{}
+	}
+
+	env := config.GetConfig()
+	info := EnvironmentInfo{
+		Name:          env.ServiceName,
+		Type:          env.ServiceType,
+		LogGroupName:  environment.GetLogGroupName(),
+		LogStreamName: env.LogStreamName,
+	}
+	if info.Name == "" {
+		info.Name = environment.GetName()
+	}
+	if info.Type == "" {
+		info.Type = environment.GetType()
+	}
+
+	sink := environment.GetSink()
+	info.SinkType = SinkType(sink.Name())
+	if agentSink, ok := sink.(*sinks.AgentSink); ok {
+		endpoint := agentSink.Endpoint
+		info.SinkEndpoint = endpoint.Protocol + "://" + net.JoinHostPort(endpoint.Host, endpoint.Port)
+	}
+
+	detection := environments.LastDetection()
+	info.Override = detection.Override
+	info.DiscoveryDuration = detection.Duration
+	for _, result := range detection.Probes {
+		info.Probes = append(info.Probes, ProbeResult(result))
+	}
+	return info
+}
+
+// String returns a single line suitable for logging at startup.
+func (e EnvironmentInfo) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "environment %s (%s), log group %q", e.Name, e.Type, e.LogGroupName)
+	if e.LogStreamName != "" {
+		fmt.Fprintf(&b, ", log stream %q", e.LogStreamName)
+	}
+	b.WriteString(", sink " + string(e.SinkType))
+	if e.SinkEndpoint != "" {
+		b.WriteString(" " + e.SinkEndpoint)
+	}
+	if e.Override != "" {
+		b.WriteString(", override " + e.Override)
+		return b.String()
+	}
+	fmt.Fprintf(&b, ", discovered in %v", e.DiscoveryDuration.Round(time.Millisecond))
+	for i, result := range e.Probes {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString("; ")
+		}
+		status := result.Reason
+		if result.Matched {
+			status = "matched"
+		}
+		fmt.Fprintf(&b, "%s %s (%v)", result.Name, status, result.Duration.Round(time.Millisecond))
+	}
+	return b.String()
+}
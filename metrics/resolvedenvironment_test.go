@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolvedEnvironmentWithOverride(t *testing.T) {
+
+	t.Cleanup(func() {
+		Reset()
+	})
+	t.Setenv("AWS_EMF_ENVIRONMENT", "Local")
+	t.Setenv("AWS_EMF_SERVICE_NAME", "checkout")
+	t.Setenv("AWS_EMF_LOG_GROUP_NAME", "")
+	t.Setenv("LOG_GROUP_NAME", "")
+	t.Setenv("AWS_EMF_LOG_STREAM_NAME", "")
+	t.Setenv("LOG_STREAM_NAME", "")
+	Reset()
+
+	info := ResolvedEnvironment()
+	if info.Name != "checkout" {
+		t.Errorf("Expected %v, got %v", "checkout", info.Name)
+	}
+	if info.LogGroupName != "checkout-metrics" {
+		t.Errorf("Expected %v, got %v", "checkout-metrics", info.LogGroupName)
+	}
+	if info.Override != "Local" || len(info.Probes) != 0 {
+		t.Errorf("Expected the Local override without probes, got %v, %v", info.Override, info.Probes)
+	}
+	if info.SinkType != ConsoleSink || info.SinkEndpoint != "" {
+		t.Errorf("Expected %v, got %v %v", ConsoleSink, info.SinkType, info.SinkEndpoint)
+	}
+}
+
+func TestEnvironmentInfoString(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		info     EnvironmentInfo
+		expected string
+	}{
+		{
+			name:     "Override",
+			info:     EnvironmentInfo{Name: "checkout", Type: "Local", LogGroupName: "checkout-metrics", SinkType: ConsoleSink, Override: "Local"},
+			expected: `environment checkout (Local), log group "checkout-metrics", sink ConsoleSink, override Local`,
+		},
+		{
+			name: "Discovery",
+			info: EnvironmentInfo{
+				Name:              "i-1",
+				Type:              "AWS::EC2::Instance",
+				LogGroupName:      "i-1-metrics",
+				LogStreamName:     "web",
+				SinkType:          AgentSink,
+				SinkEndpoint:      "tcp://0.0.0.0:25888",
+				DiscoveryDuration: 12 * time.Millisecond,
+				Probes: []ProbeResult{
+					{Name: "Lambda", Reason: "disabled by configuration"},
+					{Name: "EC2", Matched: true, Duration: 11 * time.Millisecond},
+				},
+			},
+			expected: `environment i-1 (AWS::EC2::Instance), log group "i-1-metrics", log stream "web", sink AgentSink tcp://0.0.0.0:25888, discovered in 12ms: Lambda disabled by configuration (0s); EC2 matched (11ms)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := tt.info.String(); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
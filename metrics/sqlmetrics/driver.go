@@ -0,0 +1,393 @@
+// Package sqlmetrics records embedded metrics for database/sql drivers.
+package sqlmetrics
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics"
+)
+
+const (
+	QueryLatencyMetric = "QueryLatency"
+	ExecLatencyMetric  = "ExecLatency"
+	RowsAffectedMetric = "RowsAffected"
+	QueryErrorsMetric  = "QueryErrors"
+	ExecErrorsMetric   = "ExecErrors"
+	StatementDimension = "Statement"
+	// OtherStatement replaces the fingerprint of statements that are not in the allowlist.
+	OtherStatement = "Other"
+)
+
+type driverOptions struct {
+	fingerprints map[string]bool
+}
+
+type Option func(options *driverOptions)
+
+// WithStatementFingerprints enables the Statement dimension for the given statements. The
+// dimension value is the fingerprint of the statement, see Fingerprint, and statements
+// that are not in the allowlist are recorded as "Other".
+func WithStatementFingerprints(statements ...string) Option {
+	return func(options *driverOptions) {
+		options.fingerprints = make(map[string]bool, len(statements))
+		for _, statement := range statements {
+			options.fingerprints[Fingerprint(statement)] = true
+		}
+	}
+}
+
+func newDriverOptions(options []Option) *driverOptions {
+	opts := &driverOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+	return opts
+}
+
+var (
+	stringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numericLiteral = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	valueList      = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+)
+
+// Fingerprint normalizes a statement so that statements which only differ in their
+// literals, placeholders or whitespace share one fingerprint. String and numeric literals
+// are replaced by ?, lists of them are collapsed into (?) and whitespace is collapsed.
+func Fingerprint(query string) string {
+	fingerprint := stringLiteral.ReplaceAllString(query, "?")
+	fingerprint = numericLiteral.ReplaceAllString(fingerprint, "?")
+	fingerprint = strings.Join(strings.Fields(fingerprint), " ")
+	return valueList.ReplaceAllString(fingerprint, "(?)")
+}
+
+// Register registers a driver under the given name that records metrics around d.
+func Register(name string, d driver.Driver, options ...Option) {
+	sql.Register(name, Wrap(d, options...))
+}
+
+// Wrap returns a driver that records the latency and the error count of every query and
+// exec, and the rows affected by every exec, of the connections opened with d.
+//
+// The metrics are recorded on the logger returned by metrics.FromContext for the context
+// of the call, so they are part of the event of the surrounding request. When the
+// Statement dimension is enabled, they are recorded on a child of that logger with the
+// dimension instead, which is flushed when the call completes, because the statements of
+// one request have different dimension values, which a single event cannot hold.
+func Wrap(d driver.Driver, options ...Option) driver.Driver {
+	return &wrappedDriver{driver: d, options: newDriverOptions(options)}
+}
+
+// WrapConnector is the counterpart of Wrap for connectors passed to sql.OpenDB.
+func WrapConnector(c driver.Connector, options ...Option) driver.Connector {
+	opts := newDriverOptions(options)
+	return &connector{
+		connector: c,
+		driver:    &wrappedDriver{driver: c.Driver(), options: opts},
+		options:   opts,
+	}
+}
+
+// PutDBStats records the connection pool statistics of a sql.DB, as returned by
+// (*sql.DB).Stats.
+func PutDBStats(logger *metrics.MetricsLogger, stats sql.DBStats) {
+	counts := []struct {
+		name  string
+		value int64
+	}{
+		{"MaxOpenConnections", int64(stats.MaxOpenConnections)},
+		{"OpenConnections", int64(stats.OpenConnections)},
+		{"InUseConnections", int64(stats.InUse)},
+		{"IdleConnections", int64(stats.Idle)},
+		{"WaitCount", stats.WaitCount},
+		{"MaxIdleClosed", stats.MaxIdleClosed},
+		{"MaxIdleTimeClosed", stats.MaxIdleTimeClosed},
+		{"MaxLifetimeClosed", stats.MaxLifetimeClosed},
+	}
+	for _, count := range counts {
+		logger.PutMetric(count.name, float64(count.value), metrics.Count, metrics.StorageResolutionStandard)
+	}
+	logger.PutDuration("WaitDuration", stats.WaitDuration, metrics.Milliseconds)
+}
+
+type wrappedDriver struct {
+	driver  driver.Driver
+	options *driverOptions
+}
+
+func (d *wrappedDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{conn: c, options: d.options}, nil
+}
+
+func (d *wrappedDriver) OpenConnector(name string) (driver.Connector, error) {
+	if driverContext, ok := d.driver.(driver.DriverContext); ok {
+		c, err := driverContext.OpenConnector(name)
+		if err != nil {
+			return nil, err
+		}
+		return &connector{connector: c, driver: d, options: d.options}, nil
+	}
+	return &connector{connector: dsnConnector{name: name, driver: d.driver}, driver: d, options: d.options}, nil
+}
+
+type connector struct {
+	connector driver.Connector
+	driver    driver.Driver
+	options   *driverOptions
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	driverConn, err := c.connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{conn: driverConn, options: c.options}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// dsnConnector connects drivers that do not implement driver.DriverContext.
+type dsnConnector struct {
+	name   string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.name)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type conn struct {
+	conn    driver.Conn
+	options *driverOptions
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var s driver.Stmt
+	var err error
+	if preparer, ok := c.conn.(driver.ConnPrepareContext); ok {
+		s, err = preparer.PrepareContext(ctx, query)
+	} else {
+		s, err = c.conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{stmt: s, conn: c.conn, query: query, options: c.options}, nil
+}
+
+func (c *conn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) || opts.ReadOnly {
+		return nil, errors.New("driver does not support non-default transaction options")
+	}
+	return c.conn.Begin()
+}
+
+// ExecContext returns driver.ErrSkip when the driver does not support executing without
+// preparing. database/sql then prepares the statement, whose exec is recorded instead, so
+// skipped calls are not recorded.
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.options.recordExec(ctx, query, start, result, err)
+	}
+	return result, err
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.options.recordQuery(ctx, query, start, err)
+	}
+	return rows, err
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if pinger, ok := c.conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	if validator, ok := c.conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *conn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+type stmt struct {
+	stmt    driver.Stmt
+	conn    driver.Conn
+	query   string
+	options *driverOptions
+}
+
+func (s *stmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *stmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.stmt.Exec(args)
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.stmt.Query(args)
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var result driver.Result
+	var err error
+	if execer, ok := s.stmt.(driver.StmtExecContext); ok {
+		result, err = execer.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValuesToValues(args); err == nil {
+			result, err = s.stmt.Exec(values)
+		}
+	}
+	s.options.recordExec(ctx, s.query, start, result, err)
+	return result, err
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var rows driver.Rows
+	var err error
+	if queryer, ok := s.stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValuesToValues(args); err == nil {
+			rows, err = s.stmt.Query(values)
+		}
+	}
+	s.options.recordQuery(ctx, s.query, start, err)
+	return rows, err
+}
+
+// CheckNamedValue keeps the order database/sql uses for unwrapped drivers: the checker of
+// the statement, then the checker of the connection, then the default conversion.
+func (s *stmt) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := s.stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	if checker, ok := s.conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+func namedValuesToValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("driver does not support named parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
+
+func (o *driverOptions) recordExec(ctx context.Context, query string, start time.Time, result driver.Result, err error) {
+	latency := time.Since(start)
+	logger, flush := o.logger(ctx, query)
+	logger.PutDuration(ExecLatencyMetric, latency, metrics.Milliseconds)
+	logger.PutMetric(ExecErrorsMetric, errorCount(err), metrics.Count, metrics.StorageResolutionStandard)
+	if err == nil && result != nil {
+		if rows, rowsErr := result.RowsAffected(); rowsErr == nil {
+			logger.PutMetric(RowsAffectedMetric, float64(rows), metrics.Count, metrics.StorageResolutionStandard)
+		}
+	}
+	if flush {
+		logger.Flush()
+	}
+}
+
+func (o *driverOptions) recordQuery(ctx context.Context, query string, start time.Time, err error) {
+	latency := time.Since(start)
+	logger, flush := o.logger(ctx, query)
+	logger.PutDuration(QueryLatencyMetric, latency, metrics.Milliseconds)
+	logger.PutMetric(QueryErrorsMetric, errorCount(err), metrics.Count, metrics.StorageResolutionStandard)
+	if flush {
+		logger.Flush()
+	}
+}
+
+// logger returns the logger a call is recorded on and whether it has to be flushed.
+func (o *driverOptions) logger(ctx context.Context, query string) (*metrics.MetricsLogger, bool) {
+	logger := metrics.FromContext(ctx)
+	if o.fingerprints == nil {
+		return logger, false
+	}
+	statement := Fingerprint(query)
+	if !o.fingerprints[statement] {
+		statement = OtherStatement
+	}
+	return logger.With(map[string]string{StatementDimension: statement}), true
+}
+
+func errorCount(err error) float64 {
+	if err != nil {
+		return 1
+	}
+	return 0
+}
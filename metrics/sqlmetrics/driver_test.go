@@ -0,0 +1,347 @@
+package sqlmetrics
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics"
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/testutil"
+)
+
+var output = &testutil.Events{}
+
+var errFake = errors.New("fake error")
+
+// fakeDriver executes statements without a database. Statements containing "fail" fail,
+// execs affect as many rows as the statement has arguments and queries return one row.
+// Unless prepareOnly is set, connections execute statements without preparing them. With
+// a barrier, direct queries wait for each other, so they are recorded concurrently.
+type fakeDriver struct {
+	prepareOnly bool
+	barrier     *sync.WaitGroup
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) {
+	if d.prepareOnly {
+		return &fakeConn{}, nil
+	}
+	return &fakeDirectConn{barrier: d.barrier}, nil
+}
+
+type fakeConn struct{}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return &fakeTx{}, nil
+}
+
+type fakeDirectConn struct {
+	fakeConn
+	barrier *sync.WaitGroup
+}
+
+func (c *fakeDirectConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return fakeExec(query, len(args))
+}
+
+func (c *fakeDirectConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if c.barrier != nil {
+		c.barrier.Done()
+		c.barrier.Wait()
+	}
+	return fakeQuery(query)
+}
+
+type fakeStmt struct {
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return fakeExec(s.query, len(args))
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return fakeQuery(s.query)
+}
+
+type fakeTx struct{}
+
+func (t *fakeTx) Commit() error {
+	return nil
+}
+
+func (t *fakeTx) Rollback() error {
+	return nil
+}
+
+func fakeExec(query string, args int) (driver.Result, error) {
+	if strings.Contains(query, "fail") {
+		return nil, errFake
+	}
+	return driver.RowsAffected(args), nil
+}
+
+func fakeQuery(query string) (driver.Rows, error) {
+	if strings.Contains(query, "fail") {
+		return nil, errFake
+	}
+	return &fakeRows{}, nil
+}
+
+type fakeRows struct {
+	done bool
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"value"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(42)
+	return nil
+}
+
+func openDB(t *testing.T, d driver.Driver, options ...Option) *sql.DB {
+	db := sql.OpenDB(WrapConnector(dsnConnector{driver: d}, options...))
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newRequestContext() (context.Context, *metrics.MetricsLogger) {
+	logger := testutil.NewLogger(output)
+	logger.SetProperty("RequestId", "abc")
+	return metrics.NewContext(context.Background(), logger), logger
+}
+
+func TestDriverRecordsMetricsOnTheContextLogger(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		prepareOnly bool
+	}{
+		{name: "Direct", prepareOnly: false},
+		{name: "Prepared", prepareOnly: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openDB(t, &fakeDriver{prepareOnly: tt.prepareOnly})
+			ctx, logger := newRequestContext()
+			output.Flushed(t)
+
+			if _, err := db.ExecContext(ctx, "INSERT INTO items VALUES (?, ?, ?)", 1, 2, 3); err != nil {
+				t.Fatalf("Exec failed: %v", err)
+			}
+			if _, err := db.ExecContext(ctx, "fail"); err == nil {
+				t.Fatalf("Expected exec to fail")
+			}
+			var value int
+			if err := db.QueryRowContext(ctx, "SELECT value FROM items").Scan(&value); err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if events := output.Flushed(t); len(events) != 0 {
+				t.Fatalf("Expected no event before the request logger is flushed, got %d", len(events))
+			}
+
+			logger.Flush()
+			events := output.Flushed(t)
+			if len(events) != 1 {
+				t.Fatalf("Expected 1 event, got %d", len(events))
+			}
+			event := events[0]
+
+			expectedValues := map[string]any{
+				ExecErrorsMetric:   []any{0.0, 1.0},
+				RowsAffectedMetric: []any{3.0},
+				QueryErrorsMetric:  []any{0.0},
+				"RequestId":        "abc",
+			}
+			for key, expected := range expectedValues {
+				if !reflect.DeepEqual(event[key], expected) {
+					t.Errorf("Expected %s to be %v, got %v", key, expected, event[key])
+				}
+			}
+			if latencies, ok := event[ExecLatencyMetric].([]any); !ok || len(latencies) != 2 {
+				t.Errorf("Expected 2 %s values, got %v", ExecLatencyMetric, event[ExecLatencyMetric])
+			}
+			if latencies, ok := event[QueryLatencyMetric].([]any); !ok || len(latencies) != 1 {
+				t.Errorf("Expected 1 %s value, got %v", QueryLatencyMetric, event[QueryLatencyMetric])
+			}
+		})
+	}
+}
+
+func TestDriverRecordsConcurrentQueriesOnTheContextLogger(t *testing.T) {
+
+	var barrier sync.WaitGroup
+	barrier.Add(10)
+	db := openDB(t, &fakeDriver{barrier: &barrier})
+	ctx, logger := newRequestContext()
+	output.Flushed(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db.QueryRowContext(ctx, "SELECT value FROM items").Scan(new(int))
+		}()
+	}
+	wg.Wait()
+
+	logger.Flush()
+	events := output.Flushed(t)
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	if latencies, ok := events[0][QueryLatencyMetric].([]any); !ok || len(latencies) != 10 {
+		t.Errorf("Expected 10 %s values, got %v", QueryLatencyMetric, events[0][QueryLatencyMetric])
+	}
+}
+
+func TestDriverRecordsStatementDimension(t *testing.T) {
+
+	db := openDB(t, &fakeDriver{}, WithStatementFingerprints("SELECT value FROM items WHERE id = ?"))
+	ctx, logger := newRequestContext()
+	output.Flushed(t)
+
+	db.QueryRowContext(ctx, "SELECT value FROM items WHERE id = 7").Scan(new(int))
+	db.QueryRowContext(ctx, "SELECT value FROM other").Scan(new(int))
+
+	events := output.Flushed(t)
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	for i, expected := range []string{"SELECT value FROM items WHERE id = ?", OtherStatement} {
+		if events[i][StatementDimension] != expected {
+			t.Errorf("Expected %s %q, got %v", StatementDimension, expected, events[i][StatementDimension])
+		}
+		if events[i]["RequestId"] != "abc" {
+			t.Errorf("Expected the properties of the context logger, got %v", events[i]["RequestId"])
+		}
+		directives := events[i]["_aws"].(map[string]any)["CloudWatchMetrics"].([]any)
+		dimensionSet, _ := json.Marshal(directives[0].(map[string]any)["Dimensions"])
+		if !strings.Contains(string(dimensionSet), `"`+StatementDimension+`"`) {
+			t.Errorf("Expected dimension %s in %s", StatementDimension, dimensionSet)
+		}
+	}
+
+	logger.Flush()
+	if events := output.Flushed(t); len(events) != 0 {
+		t.Errorf("Expected the context logger not to record metrics, got %v", events)
+	}
+}
+
+func TestDriverWithoutLoggerInContext(t *testing.T) {
+
+	db := openDB(t, &fakeDriver{})
+	output.Flushed(t)
+
+	if _, err := db.ExecContext(context.Background(), "INSERT INTO items VALUES (?)", 1); err != nil {
+		t.Fatalf("Exec failed: %v", err)
+	}
+	if events := output.Flushed(t); len(events) != 0 {
+		t.Errorf("Expected no event, got %d", len(events))
+	}
+}
+
+func TestRegister(t *testing.T) {
+
+	Register("sqlmetrics-fake", &fakeDriver{})
+	db, err := sql.Open("sqlmetrics-fake", "")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	ctx, logger := newRequestContext()
+	output.Flushed(t)
+	if _, err := db.ExecContext(ctx, "DELETE FROM items WHERE id = ?", 1); err != nil {
+		t.Fatalf("Exec failed: %v", err)
+	}
+	logger.Flush()
+	if event := output.Flushed(t)[0]; !reflect.DeepEqual(event[RowsAffectedMetric], []any{1.0}) {
+		t.Errorf("Expected %s to be 1, got %v", RowsAffectedMetric, event[RowsAffectedMetric])
+	}
+}
+
+func TestPutDBStats(t *testing.T) {
+
+	db := openDB(t, &fakeDriver{})
+	db.SetMaxOpenConns(5)
+	db.ExecContext(context.Background(), "INSERT INTO items VALUES (?)", 1)
+
+	ctx, logger := newRequestContext()
+	output.Flushed(t)
+	PutDBStats(metrics.FromContext(ctx), db.Stats())
+	logger.Flush()
+
+	event := output.Flushed(t)[0]
+	expectedValues := map[string]any{
+		"MaxOpenConnections": 5.0,
+		"OpenConnections":    1.0,
+		"InUseConnections":   0.0,
+		"IdleConnections":    1.0,
+		"WaitCount":          0.0,
+		"WaitDuration":       0.0,
+	}
+	for key, expected := range expectedValues {
+		if !reflect.DeepEqual(event[key], []any{expected}) {
+			t.Errorf("Expected %s to be %v, got %v", key, expected, event[key])
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"SELECT * FROM items WHERE id = ?", "SELECT * FROM items WHERE id = ?"},
+		{"SELECT * FROM items WHERE id = 42", "SELECT * FROM items WHERE id = ?"},
+		{"SELECT * FROM items\n\tWHERE name = 'it''s'", "SELECT * FROM items WHERE name = ?"},
+		{"SELECT * FROM items WHERE id IN (1, 2, 3)", "SELECT * FROM items WHERE id IN (?)"},
+		{"INSERT INTO items VALUES ($1, $2)", "INSERT INTO items VALUES ($?, $?)"},
+		{"SELECT * FROM table1", "SELECT * FROM table1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if actual := Fingerprint(tt.query); actual != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
@@ -2,7 +2,17 @@ package metrics
 
 import "github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/utils"
 
+// StorageResolution is the CloudWatch storage resolution of a metric. It implements
+// encoding.TextUnmarshaler and json.Unmarshaler, so it can be used directly in
+// configuration structs.
+type StorageResolution = utils.StorageResolution
+
 const (
 	StorageResolutionHigh     = utils.High
 	StorageResolutionStandard = utils.Standard
 )
+
+// ParseStorageResolution parses "1", "60", "high" or "standard", case-insensitively.
+func ParseStorageResolution(value string) (StorageResolution, error) {
+	return utils.ParseStorageResolution(value)
+}
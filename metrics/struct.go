@@ -0,0 +1,265 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/utils"
+)
+
+const structTagName = "emf"
+
+type fieldKind int
+
+const (
+	metricField fieldKind = iota
+	dimensionField
+	propertyField
+)
+
+type fieldPlan struct {
+	index             []int
+	name              string
+	kind              fieldKind
+	unit              Unit
+	storageResolution StorageResolution
+	isDuration        bool
+}
+
+type structPlan struct {
+	fields []fieldPlan
+	err    error
+}
+
+var (
+	structPlans  sync.Map // map[reflect.Type]*structPlan
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// PutStruct records the fields of a struct tagged with `emf:"..."` in one call.
+//
+//	type RequestSummary struct {
+//		Latency   time.Duration `emf:"Latency,unit=Milliseconds,resolution=high"`
+//		Region    string        `emf:"Region,dimension"`
+//		RequestId string        `emf:"RequestId,property"`
+//	}
+//
+// Numeric and time.Duration fields (and slices of them) are recorded as metrics, fields
+// marked as dimension are put as one dimension set and fields marked as property are set
+// as properties. Untagged fields and fields tagged with "-" are ignored.
+func (l *MetricsLogger) PutStruct(v any) {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			slogger.Error("cannot put nil struct")
+			return
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		slogger.Error(fmt.Sprintf("cannot put value of type %T, expected a struct", v))
+		return
+	}
+
+	plan := getStructPlan(value.Type())
+	if plan.err != nil {
+		slogger.Error(plan.err.Error())
+		return
+	}
+
+	dimensions := make(map[string]string)
+	for _, field := range plan.fields {
+		fieldValue, ok := fieldByIndex(value, field.index)
+		if !ok {
+			continue
+		}
+		switch field.kind {
+		case dimensionField:
+			dimensions[field.name] = fmt.Sprint(fieldValue.Interface())
+		case propertyField:
+			l.SetProperty(field.name, fieldValue.Interface())
+		case metricField:
+			l.putMetricField(field, fieldValue)
+		}
+	}
+
+	if len(dimensions) > 0 {
+		l.PutDimensions(dimensions)
+	}
+}
+
+func (l *MetricsLogger) putMetricField(field fieldPlan, value reflect.Value) {
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+	if value.Kind() == reflect.Slice || value.Kind() == reflect.Array {
+		for i := 0; i < value.Len(); i++ {
+			l.putMetricField(field, value.Index(i))
+		}
+		return
+	}
+
+	if field.isDuration {
+		converted, err := durationIn(time.Duration(value.Int()), field.unit)
+		if err != nil {
+			slogger.Error(err.Error())
+			return
+		}
+		l.PutMetric(field.name, converted, field.unit, field.storageResolution)
+		return
+	}
+
+	var number float64
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		number = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		number = value.Float()
+	}
+	l.PutMetric(field.name, number, field.unit, field.storageResolution)
+}
+
+// fieldByIndex walks embedded struct pointers and reports false when one of them, or the
+// field itself, is a nil pointer.
+func fieldByIndex(value reflect.Value, index []int) (reflect.Value, bool) {
+	for i, idx := range index {
+		if i > 0 && value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				return reflect.Value{}, false
+			}
+			value = value.Elem()
+		}
+		value = value.Field(idx)
+	}
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return reflect.Value{}, false
+		}
+		value = value.Elem()
+	}
+	return value, true
+}
+
+func getStructPlan(t reflect.Type) *structPlan {
+	if plan, ok := structPlans.Load(t); ok {
+		return plan.(*structPlan)
+	}
+	plan := &structPlan{}
+	plan.fields, plan.err = buildFieldPlans(t, nil)
+	actual, _ := structPlans.LoadOrStore(t, plan)
+	return actual.(*structPlan)
+}
+
+func buildFieldPlans(t reflect.Type, parentIndex []int) ([]fieldPlan, error) {
+	var fields []fieldPlan
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		index := append(append([]int{}, parentIndex...), i)
+		tag, tagged := field.Tag.Lookup(structTagName)
+
+		if !tagged && field.Anonymous {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				embeddedFields, err := buildFieldPlans(embedded, index)
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, embeddedFields...)
+			}
+			continue
+		}
+		if !tagged || tag == "-" || !field.IsExported() {
+			continue
+		}
+
+		plan, err := parseFieldTag(field, tag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid emf tag on field %s.%s: %w", t.Name(), field.Name, err)
+		}
+		plan.index = index
+		fields = append(fields, plan)
+	}
+	return fields, nil
+}
+
+func parseFieldTag(field reflect.StructField, tag string) (fieldPlan, error) {
+	parts := strings.Split(tag, ",")
+	plan := fieldPlan{
+		name:              strings.TrimSpace(parts[0]),
+		kind:              metricField,
+		storageResolution: utils.Standard,
+	}
+	if plan.name == "" {
+		plan.name = field.Name
+	}
+
+	unitSet := false
+	for _, option := range parts[1:] {
+		key, value, _ := strings.Cut(strings.TrimSpace(option), "=")
+		var err error
+		switch key {
+		case "dimension":
+			plan.kind = dimensionField
+		case "property":
+			plan.kind = propertyField
+		case "unit":
+			plan.unit, err = utils.ParseUnit(value)
+			unitSet = true
+		case "resolution":
+			plan.storageResolution, err = utils.ParseStorageResolution(value)
+		default:
+			err = errors.New("unknown option " + option)
+		}
+		if err != nil {
+			return plan, err
+		}
+	}
+
+	if plan.kind != metricField {
+		return plan, nil
+	}
+
+	fieldType := field.Type
+	for fieldType.Kind() == reflect.Pointer || fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Array {
+		fieldType = fieldType.Elem()
+	}
+	plan.isDuration = fieldType == durationType
+	switch {
+	case plan.isDuration:
+		if !unitSet {
+			plan.unit = utils.Milliseconds
+		}
+		if utils.GetUnitFamily(plan.unit) != utils.TimeUnits {
+			return plan, errors.New("unit " + string(plan.unit) + " is not a time unit")
+		}
+	case isNumericKind(fieldType.Kind()):
+		if !unitSet {
+			plan.unit = utils.None
+		}
+	default:
+		return plan, errors.New("metric fields must be numeric or time.Duration, got " + fieldType.String())
+	}
+	return plan, nil
+}
+
+func isNumericKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/utils"
+)
+
+type requestSummary struct {
+	Latency   time.Duration `emf:"Latency,unit=Milliseconds,resolution=high"`
+	Size      int           `emf:"ResponseSize,unit=bytes"`
+	Retries   []float64     `emf:"Retries,unit=count"`
+	Cache     *int          `emf:"CacheHits"`
+	Region    string        `emf:"Region,dimension"`
+	Operation string        `emf:"Operation,dimension"`
+	RequestId string        `emf:"RequestId,property"`
+	Ignored   int           `emf:"-"`
+	Untagged  int
+}
+
+func TestPutStructRecordsMetricsDimensionsAndProperties(t *testing.T) {
+
+	logger := newTestLogger()
+	logger.PutStruct(&requestSummary{
+		Latency:   1500 * time.Microsecond,
+		Size:      512,
+		Retries:   []float64{1, 2},
+		Region:    "eu-central-1",
+		Operation: "GetItem",
+		RequestId: "abc",
+		Ignored:   1,
+		Untagged:  1,
+	})
+
+	latency := logger.context.Metrics["Latency"]
+	if latency.Unit != Milliseconds || latency.StorageResolution != StorageResolutionHigh || latency.Values[0] != 1.5 {
+		t.Errorf("Expected 1.5 Milliseconds with high resolution, got %v", latency)
+	}
+	if size := logger.context.Metrics["ResponseSize"]; size.Unit != Bytes || size.Values[0] != 512 {
+		t.Errorf("Expected 512 Bytes, got %v", size)
+	}
+	if retries := logger.context.Metrics["Retries"]; retries.Unit != Count || !utils.AreFloat64SlicesEqual(retries.Values, []float64{1, 2}) {
+		t.Errorf("Expected [1 2] Count, got %v", retries)
+	}
+	for _, name := range []string{"CacheHits", "Ignored", "Untagged"} {
+		if _, ok := logger.context.Metrics[name]; ok {
+			t.Errorf("Expected %s not to be recorded", name)
+		}
+	}
+
+	expectedDimensions := map[string]string{"Region": "eu-central-1", "Operation": "GetItem"}
+	if !utils.AreMapsEqual(expectedDimensions, logger.context.GetDimensions()[0]) {
+		t.Errorf("Expected %v, got %v", expectedDimensions, logger.context.GetDimensions()[0])
+	}
+	if logger.context.Properties["RequestId"] != "abc" {
+		t.Errorf("Expected %v, got %v", "abc", logger.context.Properties["RequestId"])
+	}
+}
+
+type embeddedSummary struct {
+	requestSummaryBase
+	Count int `emf:"Items,unit=Count"`
+}
+
+type requestSummaryBase struct {
+	Service string `emf:"Service,dimension"`
+}
+
+func TestPutStructFollowsEmbeddedStructs(t *testing.T) {
+
+	logger := newTestLogger()
+	logger.PutStruct(embeddedSummary{requestSummaryBase{"api"}, 3})
+
+	if logger.context.Metrics["Items"].Values[0] != 3 {
+		t.Errorf("Expected %v, got %v", 3, logger.context.Metrics["Items"].Values)
+	}
+	if logger.context.GetDimensions()[0]["Service"] != "api" {
+		t.Errorf("Expected %v, got %v", "api", logger.context.GetDimensions())
+	}
+}
+
+func TestPutStructCachesPlanPerType(t *testing.T) {
+
+	first := getStructPlan(reflect.TypeOf(requestSummary{}))
+	second := getStructPlan(reflect.TypeOf(requestSummary{}))
+
+	if first != second {
+		t.Errorf("Expected the cached plan to be reused")
+	}
+}
+
+func TestPutStructWithInvalidTagRecordsNothing(t *testing.T) {
+
+	testCases := []struct {
+		name  string
+		value any
+	}{
+		{"Invalid unit", struct {
+			Value int `emf:"Value,unit=furlongs"`
+		}{1}},
+		{"Non time unit for duration", struct {
+			Value time.Duration `emf:"Value,unit=Bytes"`
+		}{1}},
+		{"Non numeric metric", struct {
+			Value string `emf:"Value"`
+		}{"1"}},
+		{"Unknown option", struct {
+			Value int `emf:"Value,histogram"`
+		}{1}},
+		{"Not a struct", 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := newTestLogger()
+			logger.PutStruct(tc.value)
+			if len(logger.context.Metrics) != 0 {
+				t.Errorf("Expected no metrics, got %v", logger.context.Metrics)
+			}
+		})
+	}
+}
@@ -2,6 +2,10 @@ package metrics
 
 import "github.com/tomkalesse/aws-embedded-metrics-go/metrics/internal/utils"
 
+// Unit is a CloudWatch metric unit. It implements encoding.TextUnmarshaler and
+// json.Unmarshaler, so it can be used directly in configuration structs.
+type Unit = utils.Unit
+
 const (
 	Seconds            = utils.Seconds
 	Microseconds       = utils.Microseconds
@@ -31,3 +35,9 @@ const (
 	CountPerSecond     = utils.CountPerSecond
 	None               = utils.None
 )
+
+// ParseUnit parses a unit name case-insensitively, accepting aliases like "ms", "bytes/s"
+// or "count/sec".
+func ParseUnit(value string) (Unit, error) {
+	return utils.ParseUnit(value)
+}
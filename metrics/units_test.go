@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseUnit(t *testing.T) {
+
+	testCases := []struct {
+		value    string
+		expected Unit
+	}{
+		{"Seconds", Seconds},
+		{"milliseconds", Milliseconds},
+		{"ms", Milliseconds},
+		{"MS", Milliseconds},
+		{"us", Microseconds},
+		{"Bytes", Bytes},
+		{"kb", Kilobytes},
+		{"Megabits", Megabits},
+		{"Bytes/Second", BytesPerSecond},
+		{"bytes/s", BytesPerSecond},
+		{"kilobytes / sec", KilobytesPerSecond},
+		{"mbps", MegabitsPerSecond},
+		{"count/sec", CountPerSecond},
+		{"Count", Count},
+		{"%", Percent},
+		{"none", None},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			unit, err := ParseUnit(tc.value)
+			if err != nil {
+				t.Fatalf("Expected nil but got error %v", err)
+			}
+			if unit != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, unit)
+			}
+		})
+	}
+}
+
+func TestParseUnitWithInvalidUnitThrowsError(t *testing.T) {
+
+	for _, value := range []string{"", "furlongs", "percent/s", "ms/hour"} {
+		t.Run(value, func(t *testing.T) {
+			if _, err := ParseUnit(value); err == nil {
+				t.Errorf("Expected error but got nil")
+			}
+		})
+	}
+}
+
+func TestParseStorageResolution(t *testing.T) {
+
+	testCases := []struct {
+		value    string
+		expected StorageResolution
+	}{
+		{"1", StorageResolutionHigh},
+		{"high", StorageResolutionHigh},
+		{"HIGH", StorageResolutionHigh},
+		{"60", StorageResolutionStandard},
+		{"Standard", StorageResolutionStandard},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			resolution, err := ParseStorageResolution(tc.value)
+			if err != nil {
+				t.Fatalf("Expected nil but got error %v", err)
+			}
+			if resolution != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, resolution)
+			}
+		})
+	}
+
+	if _, err := ParseStorageResolution("5"); err == nil {
+		t.Errorf("Expected error but got nil")
+	}
+}
+
+func TestUnmarshalMetricDefinitionFromJSON(t *testing.T) {
+
+	var definitions []struct {
+		Unit       Unit              `json:"unit"`
+		Resolution StorageResolution `json:"resolution"`
+	}
+	data := `[{"unit": "ms", "resolution": "high"}, {"unit": "Bytes/Second", "resolution": 60}]`
+
+	if err := json.Unmarshal([]byte(data), &definitions); err != nil {
+		t.Fatalf("Expected nil but got error %v", err)
+	}
+	if definitions[0].Unit != Milliseconds || definitions[0].Resolution != StorageResolutionHigh {
+		t.Errorf("Expected %v/%v, got %v/%v", Milliseconds, StorageResolutionHigh, definitions[0].Unit, definitions[0].Resolution)
+	}
+	if definitions[1].Unit != BytesPerSecond || definitions[1].Resolution != StorageResolutionStandard {
+		t.Errorf("Expected %v/%v, got %v/%v", BytesPerSecond, StorageResolutionStandard, definitions[1].Unit, definitions[1].Resolution)
+	}
+
+	var invalid struct {
+		Unit Unit `json:"unit"`
+	}
+	if err := json.Unmarshal([]byte(`{"unit": "furlongs"}`), &invalid); err == nil {
+		t.Errorf("Expected error but got nil")
+	}
+}
+
+func TestUnmarshalText(t *testing.T) {
+
+	var unit Unit
+	if err := unit.UnmarshalText([]byte("count/s")); err != nil || unit != CountPerSecond {
+		t.Errorf("Expected %v, got %v (%v)", CountPerSecond, unit, err)
+	}
+
+	var resolution StorageResolution
+	if err := resolution.UnmarshalText([]byte("high")); err != nil || resolution != StorageResolutionHigh {
+		t.Errorf("Expected %v, got %v (%v)", StorageResolutionHigh, resolution, err)
+	}
+}